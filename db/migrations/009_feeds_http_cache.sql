@@ -0,0 +1,13 @@
+-- +goose Up
+
+-- HTTP cache validators from the last successful fetch, sent back as
+-- If-None-Match / If-Modified-Since so publishers can answer 304.
+ALTER TABLE feeds
+ADD COLUMN etag TEXT,
+ADD COLUMN last_modified TEXT;
+
+-- +goose Down
+
+ALTER TABLE feeds
+DROP COLUMN etag,
+DROP COLUMN last_modified;
@@ -0,0 +1,39 @@
+-- +goose Up
+
+ALTER TABLE posts
+ADD COLUMN content TEXT,      -- full body (content:encoded, atom content, content_html)
+ADD COLUMN author TEXT,
+ADD COLUMN comments_url TEXT,
+ADD COLUMN image_url TEXT;    -- media:thumbnail or first image
+
+-- Files attached to a post (podcast audio, video, images)
+CREATE TABLE post_enclosures (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    mime_type TEXT,
+    length BIGINT,
+
+    UNIQUE (post_id, url) -- also serves the "enclosures of these posts" lookup
+);
+
+CREATE TABLE post_categories (
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+
+    PRIMARY KEY (post_id, name)
+);
+
+-- +goose Down
+
+DROP TABLE post_categories;
+
+DROP TABLE post_enclosures;
+
+ALTER TABLE posts
+DROP COLUMN content,
+DROP COLUMN author,
+DROP COLUMN comments_url,
+DROP COLUMN image_url;
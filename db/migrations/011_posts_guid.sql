@@ -0,0 +1,32 @@
+-- +goose Up
+
+-- A post is identified by its feed + guid (<guid>, atom <id>, or a content hash
+-- when the item has none) instead of a globally unique URL. Two feeds can
+-- link the same article and items without <link> no longer collide on ''.
+ALTER TABLE posts ADD COLUMN guid TEXT;
+
+-- Backfill: the URL was the identity until now and most feeds use the link as
+-- <guid>, so it's the best guess we have. Posts of feeds whose <guid> is
+-- something else are re-keyed when their item is next ingested
+-- (AdoptLegacyPosts). Posts without URL get the same content hash the scraper
+-- falls back to (sha256 of link, title, description).
+UPDATE posts SET guid = url WHERE url <> '';
+
+UPDATE posts
+SET guid = encode(sha256(convert_to(url || E'\n' || title || E'\n' || coalesce(description, ''), 'UTF8')), 'hex')
+WHERE guid IS NULL;
+
+ALTER TABLE posts ALTER COLUMN guid SET NOT NULL;
+
+ALTER TABLE posts DROP CONSTRAINT posts_url_key;
+
+ALTER TABLE posts ADD CONSTRAINT posts_feed_id_guid_key UNIQUE (feed_id, guid);
+
+-- +goose Down
+
+-- fails if two feeds ingested the same URL after the Up, dedupe first
+ALTER TABLE posts DROP CONSTRAINT posts_feed_id_guid_key;
+
+ALTER TABLE posts ADD CONSTRAINT posts_url_key UNIQUE (url);
+
+ALTER TABLE posts DROP COLUMN guid;
@@ -0,0 +1,30 @@
+-- +goose Up
+
+-- sha256 of title, description and content. Lets the scraper tell an edited
+-- item from an unchanged one without comparing every column.
+ALTER TABLE posts ADD COLUMN content_hash TEXT;
+
+-- keep in sync with feeds.Item.ContentHash
+UPDATE posts
+SET content_hash = encode(sha256(convert_to(title || E'\n' || coalesce(description, '') || E'\n' || coalesce(content, ''), 'UTF8')), 'hex');
+
+ALTER TABLE posts ALTER COLUMN content_hash SET NOT NULL;
+
+-- Previous versions of a post, one row every time the publisher edits it
+CREATE TABLE post_revisions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT now(), -- when we noticed the edit
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    description TEXT,
+    content_hash TEXT NOT NULL
+);
+
+CREATE INDEX post_revisions_post_id_idx
+ON post_revisions (post_id, created_at);
+
+-- +goose Down
+
+DROP TABLE post_revisions;
+
+ALTER TABLE posts DROP COLUMN content_hash;
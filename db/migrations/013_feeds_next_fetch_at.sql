@@ -0,0 +1,12 @@
+-- +goose Up
+
+-- When the feed is due again. Worked out after every fetch from how often the
+-- feed publishes and the publisher's hints, new feeds are due right away.
+ALTER TABLE feeds ADD COLUMN next_fetch_at TIMESTAMP NOT NULL DEFAULT now();
+
+CREATE INDEX feeds_next_fetch_at_idx
+ON feeds (next_fetch_at);
+
+-- +goose Down
+
+ALTER TABLE feeds DROP COLUMN next_fetch_at;
@@ -0,0 +1,19 @@
+-- +goose Up
+
+-- Health of the feed. consecutive_failures drives the backoff and goes back to
+-- 0 on the next success, last_error is kept around for diagnostics.
+ALTER TABLE feeds
+ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0,
+ADD COLUMN last_error TEXT,
+ADD COLUMN last_error_at TIMESTAMP,
+ADD COLUMN last_success_at TIMESTAMP,
+ADD COLUMN disabled_at TIMESTAMP; -- set once the feed failed too many times in a row, the scraper skips it
+
+-- +goose Down
+
+ALTER TABLE feeds
+DROP COLUMN consecutive_failures,
+DROP COLUMN last_error,
+DROP COLUMN last_error_at,
+DROP COLUMN last_success_at,
+DROP COLUMN disabled_at;
@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- Scraper instance currently working on the feed. A feed is claimed by one
+-- instance at a time, once the lease expires (instance crashed) anyone can
+-- claim it again.
+ALTER TABLE feeds
+ADD COLUMN lease_owner TEXT,
+ADD COLUMN lease_expires_at TIMESTAMP;
+
+-- +goose Down
+
+ALTER TABLE feeds
+DROP COLUMN lease_owner,
+DROP COLUMN lease_expires_at;
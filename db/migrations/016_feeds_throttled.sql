@@ -0,0 +1,12 @@
+-- +goose Up
+
+-- Set when the publisher answered 429/503 (or we held back to be polite), the
+-- feed is not fetched before then. Unlike failures it doesn't count towards
+-- disabling the feed.
+ALTER TABLE feeds
+ADD COLUMN throttled_until TIMESTAMP;
+
+-- +goose Down
+
+ALTER TABLE feeds
+DROP COLUMN throttled_until;
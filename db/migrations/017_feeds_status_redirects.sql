@@ -0,0 +1,19 @@
+-- +goose Up
+
+-- status: 'active', or 'dead' once the publisher answered 410 Gone. Dead
+-- feeds are not scraped anymore, followers see it on their follows.
+--
+-- redirect_url/redirect_count: where the last fetches were permanently
+-- redirected (301/308) and how many times in a row. The scraper moves the feed
+-- there once it's consistent enough, a single redirect could be a mistake.
+ALTER TABLE feeds
+ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'dead')),
+ADD COLUMN redirect_url TEXT,
+ADD COLUMN redirect_count INTEGER NOT NULL DEFAULT 0;
+
+-- +goose Down
+
+ALTER TABLE feeds
+DROP COLUMN status,
+DROP COLUMN redirect_url,
+DROP COLUMN redirect_count;
@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- One WebSub subscription per feed. state goes pending → subscribed once the
+-- hub verified it (or denied), lease_expires_at is when the hub stops pushing
+-- unless we renew. secret signs the pushes (X-Hub-Signature).
+CREATE TABLE websub_subscriptions (
+    feed_id UUID PRIMARY KEY REFERENCES feeds(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now(), -- also when we last asked the hub
+    hub_url TEXT NOT NULL,
+    topic_url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    state TEXT NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'subscribed', 'denied')),
+    lease_seconds INTEGER,
+    lease_expires_at TIMESTAMP
+);
+
+-- +goose Down
+
+DROP TABLE websub_subscriptions;
@@ -0,0 +1,26 @@
+-- +goose Up
+
+-- One row per scrape of a feed, to find out why a feed stopped updating
+-- without digging through logs. http_status is NULL when we got no response
+-- (DNS, timeout, blocked URL...). Only the latest runs of each feed are kept,
+-- the scraper trims the rest.
+CREATE TABLE feed_fetches (
+    id UUID PRIMARY KEY,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    http_status INTEGER,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    items_seen INTEGER NOT NULL DEFAULT 0,
+    posts_inserted INTEGER NOT NULL DEFAULT 0,
+    posts_updated INTEGER NOT NULL DEFAULT 0,
+    posts_skipped INTEGER NOT NULL DEFAULT 0,
+    error TEXT
+);
+
+CREATE INDEX feed_fetches_feed_id_started_at_idx ON feed_fetches (feed_id, started_at DESC);
+
+-- +goose Down
+
+DROP TABLE feed_fetches;
@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- Admins can use the /v1/admin routes (scraper controls). Granted by hand:
+-- UPDATE users SET is_admin = true WHERE id = '...';
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- +goose Down
+
+ALTER TABLE users DROP COLUMN is_admin;
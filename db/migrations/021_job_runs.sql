@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- One row per run of a maintenance job (internal/tasks Scheduler). A job
+-- runs once per slot of its schedule whatever the number of instances: the
+-- first one to insert the (job_name, scheduled_for) row runs it, the others
+-- skip. finished_at stays NULL while it runs, or if its instance died.
+CREATE TABLE job_runs (
+    id UUID PRIMARY KEY,
+    job_name TEXT NOT NULL,
+    scheduled_for TIMESTAMP NOT NULL,
+    instance_id TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP,
+    error TEXT,
+    UNIQUE (job_name, scheduled_for)
+);
+
+-- +goose Down
+
+DROP TABLE job_runs;
@@ -0,0 +1,20 @@
+-- +goose Up
+
+-- Per feed overrides of the global post retention (POST_RETENTION_* env).
+-- NULL keeps the global value, 0 means no limit for this feed.
+CREATE TABLE feed_retention_policies (
+    feed_id UUID PRIMARY KEY REFERENCES feeds(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    keep_days INTEGER CHECK (keep_days >= 0),
+    keep_posts INTEGER CHECK (keep_posts >= 0)
+);
+
+-- ranks the posts of a feed by age, for pruning (keep the latest N)
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at DESC);
+
+-- +goose Down
+
+DROP INDEX posts_feed_id_published_at_idx;
+
+DROP TABLE feed_retention_policies;
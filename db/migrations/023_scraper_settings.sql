@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- What admins set on the scraper (pause, concurrency, interval), shared by
+-- every instance: each one reads it on every tick. One row only. NULL keeps
+-- what the instance started with.
+CREATE TABLE scraper_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    paused BOOLEAN NOT NULL DEFAULT FALSE,
+    concurrency INTEGER CHECK (concurrency > 0),
+    interval_seconds INTEGER CHECK (interval_seconds > 0)
+);
+
+INSERT INTO scraper_settings DEFAULT VALUES;
+
+-- +goose Down
+
+DROP TABLE scraper_settings;
@@ -0,0 +1,11 @@
+-- +goose Up
+
+-- The pace worked out from the feed's publishing rate and hints on its last
+-- full fetch, kept for the 304s that follow: next_fetch_at - last_fetched_at
+-- can't tell it, that gap also holds failure backoffs and Retry-After waits.
+-- NULL until the first full fetch.
+ALTER TABLE feeds ADD COLUMN fetch_interval_seconds INTEGER;
+
+-- +goose Down
+
+ALTER TABLE feeds DROP COLUMN fetch_interval_seconds;
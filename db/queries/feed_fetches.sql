@@ -0,0 +1,38 @@
+-- name: CreateFeedFetch :exec
+-- started_at is derived from the duration so both timestamps use the
+-- database clock.
+INSERT INTO feed_fetches (id, feed_id, started_at, finished_at, duration_ms, http_status, bytes, items_seen, posts_inserted, posts_updated, posts_skipped, error)
+VALUES (
+    sqlc.arg(id),
+    sqlc.arg(feed_id),
+    NOW() - (sqlc.arg(duration_ms)::bigint * interval '1 millisecond'),
+    NOW(),
+    sqlc.arg(duration_ms)::bigint,
+    sqlc.arg(http_status),
+    sqlc.arg(bytes),
+    sqlc.arg(items_seen),
+    sqlc.arg(posts_inserted),
+    sqlc.arg(posts_updated),
+    sqlc.arg(posts_skipped),
+    sqlc.arg(error)
+);
+
+-- name: TrimFeedFetches :exec
+-- Keeps the latest runs of the feed only.
+DELETE FROM feed_fetches
+WHERE feed_id = sqlc.arg(feed_id)
+AND id NOT IN (
+    SELECT id FROM feed_fetches
+    WHERE feed_id = sqlc.arg(feed_id)
+    ORDER BY started_at DESC
+    LIMIT sqlc.arg(keep)
+);
+
+-- name: GetFeedFetch :one
+SELECT * FROM feed_fetches WHERE id = $1;
+
+-- name: GetFeedFetches :many
+SELECT * FROM feed_fetches
+WHERE feed_id = $1
+ORDER BY started_at DESC
+LIMIT $2;
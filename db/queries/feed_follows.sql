@@ -5,7 +5,22 @@ RETURNING *;
 
 
 -- name: GetFeedFollows :many
-SELECT * from feed_follows where user_id = $1;
+-- feed_status tells followers when a feed died
+SELECT feed_follows.*, feeds.status AS feed_status
+FROM feed_follows
+JOIN feeds ON feeds.id = feed_follows.feed_id
+WHERE feed_follows.user_id = $1;
 
 -- name: DeleteFeedFollow :execrows
-DELETE FROM feed_follows WHERE id = $1 AND user_id = $2;
\ No newline at end of file
+DELETE FROM feed_follows WHERE id = $1 AND user_id = $2;
+
+-- name: MoveFeedFollows :exec
+-- Used when merging feeds, users already following the target keep their
+-- follow and the duplicate is deleted with DeleteFeedFollowsForFeed.
+UPDATE feed_follows
+SET feed_id = sqlc.arg(to_feed_id), updated_at = NOW()
+WHERE feed_id = sqlc.arg(from_feed_id)
+AND user_id NOT IN (SELECT user_id FROM feed_follows WHERE feed_id = sqlc.arg(to_feed_id));
+
+-- name: DeleteFeedFollowsForFeed :exec
+DELETE FROM feed_follows WHERE feed_id = $1;
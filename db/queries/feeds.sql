@@ -7,14 +7,158 @@ RETURNING *;
 SELECT * FROM feeds;
 
 
--- name: GetNextFeedsToFetch :many
-SELECT * FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1;
+-- name: ClaimFeedsToFetch :many
+-- Leases the next due feeds to this instance. SKIP LOCKED makes concurrent
+-- instances pick different rows instead of waiting on each other, and feeds
+-- leased by someone else are skipped until the lease expires.
+UPDATE feeds
+SET lease_owner = sqlc.arg(lease_owner),
+lease_expires_at = NOW() + (sqlc.arg(lease_seconds)::bigint * interval '1 second')
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE next_fetch_at <= NOW()
+    AND disabled_at IS NULL
+    AND status = 'active'
+    AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+    ORDER BY next_fetch_at ASC
+    LIMIT sqlc.arg(max_feeds)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: ClaimFeedForRefresh :one
+-- Leases one feed for an on-demand scrape, due or not. No rows when someone
+-- else holds its lease or it's not scraped anymore (dead or disabled).
+UPDATE feeds
+SET lease_owner = sqlc.arg(lease_owner),
+lease_expires_at = NOW() + (sqlc.arg(lease_seconds)::bigint * interval '1 second')
+WHERE id = sqlc.arg(id)
+AND disabled_at IS NULL
+AND status = 'active'
+AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+RETURNING *;
+
+-- name: ReleaseFeedLeases :exec
+-- Gives back whatever the instance still holds, on shutdown.
+UPDATE feeds
+SET lease_owner = NULL,
+lease_expires_at = NULL
+WHERE lease_owner = $1;
 
 -- name: MarkFeedAsFetched :one
+-- next_fetch_at is provisional, so a feed that fails isn't retried every tick.
+-- Computed from NOW() like last_fetched_at so both use the database clock.
 UPDATE feeds
 SET last_fetched_at = NOW(),
+next_fetch_at = NOW() + (sqlc.arg(next_fetch_in_seconds)::bigint * interval '1 second'),
+updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: UpdateFeedCacheValidators :exec
+UPDATE feeds
+SET etag = $2,
+last_modified = $3
+WHERE id = $1;
+
+-- name: RecordFeedSuccess :exec
+-- fetch_interval_seconds is the feed's own pace, next_fetch_in_seconds when we
+-- fetch it next (the pace with the Cache-Control hints, or WebSub's).
+UPDATE feeds
+SET consecutive_failures = 0,
+last_success_at = NOW(),
+lease_owner = NULL,
+lease_expires_at = NULL,
+next_fetch_at = NOW() + (sqlc.arg(next_fetch_in_seconds)::bigint * interval '1 second'),
+fetch_interval_seconds = sqlc.arg(fetch_interval_seconds)::integer,
 updated_at = NOW()
-WHERE id = $1
+WHERE id = sqlc.arg(id);
+
+-- name: RecordFeedFailure :one
+-- Pushes the feed back by retry_in_seconds and disables it once it reaches
+-- max_failures in a row.
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+last_error = sqlc.arg(last_error),
+last_error_at = NOW(),
+next_fetch_at = NOW() + (sqlc.arg(retry_in_seconds)::bigint * interval '1 second'),
+disabled_at = CASE
+    WHEN consecutive_failures + 1 >= sqlc.arg(max_failures)::integer THEN NOW()
+    ELSE disabled_at
+END,
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = sqlc.arg(id)
 RETURNING *;
+
+-- name: RecordFeedThrottled :exec
+-- The publisher asked us to slow down, the feed waits retry_in_seconds but
+-- it's not a failure so it keeps its failure count.
+UPDATE feeds
+SET throttled_until = NOW() + (sqlc.arg(retry_in_seconds)::bigint * interval '1 second'),
+next_fetch_at = NOW() + (sqlc.arg(retry_in_seconds)::bigint * interval '1 second'),
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: MarkFeedDead :exec
+-- The publisher answered 410 Gone, the feed won't be scraped again.
+UPDATE feeds
+SET status = 'dead',
+last_error = sqlc.arg(last_error),
+last_error_at = NOW(),
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: RecordFeedRedirect :one
+-- Counts fetches permanently redirected to the same URL in a row, a different
+-- target starts over at 1.
+UPDATE feeds
+SET redirect_count = CASE
+    WHEN redirect_url = sqlc.arg(redirect_url)::text THEN redirect_count + 1
+    ELSE 1
+END,
+redirect_url = sqlc.arg(redirect_url)::text,
+updated_at = NOW()
+WHERE id = sqlc.arg(id)
+RETURNING redirect_count;
+
+-- name: ResetFeedRedirect :exec
+UPDATE feeds
+SET redirect_url = NULL,
+redirect_count = 0,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: GetFeedByID :one
+SELECT * FROM feeds WHERE id = $1;
+
+-- name: GetFeedByURL :one
+SELECT * FROM feeds WHERE url = $1;
+
+-- name: UpdateFeedURL :exec
+-- Moves the feed to where it's permanently redirected.
+UPDATE feeds
+SET url = $2,
+redirect_url = NULL,
+redirect_count = 0,
+updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = $1;
+
+-- name: GetOverdueFeedStats :one
+-- Feeds due but not claimed yet and how late the oldest one is, both grow
+-- when scraping stalls.
+SELECT COUNT(*) AS overdue,
+COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(next_fetch_at)), 0)::bigint AS max_delay_seconds
+FROM feeds
+WHERE next_fetch_at <= NOW()
+AND disabled_at IS NULL
+AND status = 'active'
+AND (lease_expires_at IS NULL OR lease_expires_at < NOW());
@@ -0,0 +1,21 @@
+-- name: TryAdvisoryLock :one
+-- Session lock: it must be released on the same connection (sql.Conn).
+SELECT pg_try_advisory_lock(sqlc.arg(key)::bigint) AS locked;
+
+-- name: ReleaseAdvisoryLock :one
+SELECT pg_advisory_unlock(sqlc.arg(key)::bigint) AS released;
+
+-- name: StartJobRun :execrows
+-- 0 rows when another instance already ran this slot.
+INSERT INTO job_runs (id, job_name, scheduled_for, instance_id)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (job_name, scheduled_for) DO NOTHING;
+
+-- name: FinishJobRun :exec
+UPDATE job_runs
+SET finished_at = NOW(), error = $2
+WHERE id = $1;
+
+-- name: DeleteJobRunsBefore :execrows
+DELETE FROM job_runs
+WHERE started_at < NOW() - (sqlc.arg(age_seconds)::bigint * interval '1 second');
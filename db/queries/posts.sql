@@ -1,10 +1,134 @@
--- name: CreatePost :one
-INSERT INTO posts (id, title, description, published_at, url, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING *;
+-- name: AdoptLegacyPosts :execrows
+-- Posts stored before guids existed were keyed by their url (migration 011).
+-- When the feed now gives one of them a different guid, the post is re-keyed
+-- to it so UpsertPosts updates it instead of inserting a duplicate. Only posts
+-- still keyed by their url, and only when the feed has no post with that guid
+-- yet. Element i of each array is item i, one post per url at most.
+UPDATE posts
+SET guid = item.guid
+FROM (
+    SELECT DISTINCT ON (item.url) item.guid, item.url
+    FROM unnest(sqlc.arg(guids)::text[], sqlc.arg(urls)::text[]) AS item(guid, url)
+    WHERE item.url <> '' AND item.guid <> item.url
+    ORDER BY item.url, item.guid
+) item
+WHERE posts.feed_id = sqlc.arg(feed_id) AND posts.url = item.url AND posts.guid = posts.url
+AND NOT EXISTS (
+    SELECT 1 FROM posts existing
+    WHERE existing.feed_id = sqlc.arg(feed_id) AND existing.guid = item.guid
+);
+
+-- name: UpsertPosts :many
+-- Inserts the posts of a feed or updates the ones whose content hash changed,
+-- in one statement: element i of each array is post i, no guid twice (ON
+-- CONFLICT can't update a row twice). Unchanged posts are not returned.
+-- inserted is true for new posts (xmax is only set on rows that were updated).
+-- Empty optional fields are stored as NULL. Items without a usable date
+-- (has_dates false) keep the published_at they were first stored with, an
+-- edit must not bring them back to the top.
+INSERT INTO posts (id, title, description, published_at, url, feed_id, content, author, comments_url, image_url, guid, content_hash)
+SELECT item.id, item.title, NULLIF(item.description, ''),
+CASE WHEN item.has_date THEN item.published_at ELSE COALESCE(
+    (SELECT posts.published_at FROM posts WHERE posts.feed_id = sqlc.arg(feed_id) AND posts.guid = item.guid),
+    item.published_at
+) END,
+item.url, sqlc.arg(feed_id),
+NULLIF(item.content, ''), NULLIF(item.author, ''), NULLIF(item.comments_url, ''), NULLIF(item.image_url, ''), item.guid, item.content_hash
+FROM unnest(
+    sqlc.arg(ids)::uuid[],
+    sqlc.arg(titles)::text[],
+    sqlc.arg(descriptions)::text[],
+    sqlc.arg(published_ats)::timestamp[],
+    sqlc.arg(urls)::text[],
+    sqlc.arg(contents)::text[],
+    sqlc.arg(authors)::text[],
+    sqlc.arg(comments_urls)::text[],
+    sqlc.arg(image_urls)::text[],
+    sqlc.arg(guids)::text[],
+    sqlc.arg(content_hashes)::text[],
+    sqlc.arg(has_dates)::boolean[]
+) AS item(id, title, description, published_at, url, content, author, comments_url, image_url, guid, content_hash, has_date)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+description = EXCLUDED.description,
+published_at = EXCLUDED.published_at,
+url = EXCLUDED.url,
+content = EXCLUDED.content,
+author = EXCLUDED.author,
+comments_url = EXCLUDED.comments_url,
+image_url = EXCLUDED.image_url,
+content_hash = EXCLUDED.content_hash,
+updated_at = NOW()
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING id, guid, (xmax = 0)::boolean AS inserted;
+
+-- name: CreatePostRevisions :exec
+-- Snapshots the current version of the posts UpsertPosts is about to
+-- overwrite. Posts that don't exist yet or whose hash didn't change are left
+-- alone, and so are the ones whose title and description stay the same:
+-- that's all a revision keeps (e.g. old posts only getting their content).
+INSERT INTO post_revisions (id, post_id, title, description, content_hash)
+SELECT item.id, posts.id, posts.title, posts.description, posts.content_hash
+FROM posts
+JOIN unnest(
+    sqlc.arg(ids)::uuid[],
+    sqlc.arg(guids)::text[],
+    sqlc.arg(titles)::text[],
+    sqlc.arg(descriptions)::text[],
+    sqlc.arg(content_hashes)::text[]
+) AS item(id, guid, title, description, content_hash) ON posts.guid = item.guid
+WHERE posts.feed_id = sqlc.arg(feed_id) AND posts.content_hash <> item.content_hash
+AND (posts.title <> item.title OR posts.description IS DISTINCT FROM NULLIF(item.description, ''));
+
+-- name: GetPostByID :one
+SELECT * FROM posts WHERE id = $1;
+
+-- name: GetPostRevisions :many
+SELECT * FROM post_revisions
+WHERE post_id = $1
+ORDER BY created_at DESC;
 
 
 -- name: GetPostsForUser :many
 SELECT posts.* from posts
 JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
-WHERE feed_follows.user_id = $1 LIMIT $2;
\ No newline at end of file
+WHERE feed_follows.user_id = $1 LIMIT $2;
+
+-- name: CreatePostEnclosures :exec
+-- Element i of each array is enclosure i. A 0 length or empty mime type is
+-- stored as NULL.
+INSERT INTO post_enclosures (id, post_id, url, mime_type, length)
+SELECT enclosure.id, enclosure.post_id, enclosure.url, NULLIF(enclosure.mime_type, ''), NULLIF(enclosure.length, 0)
+FROM unnest(
+    sqlc.arg(ids)::uuid[],
+    sqlc.arg(post_ids)::uuid[],
+    sqlc.arg(urls)::text[],
+    sqlc.arg(mime_types)::text[],
+    sqlc.arg(lengths)::bigint[]
+) AS enclosure(id, post_id, url, mime_type, length)
+ON CONFLICT (post_id, url) DO NOTHING;
+
+-- name: CreatePostCategories :exec
+-- Element i of each array is category i.
+INSERT INTO post_categories (post_id, name)
+SELECT category.post_id, category.name
+FROM unnest(sqlc.arg(post_ids)::uuid[], sqlc.arg(names)::text[]) AS category(post_id, name)
+ON CONFLICT DO NOTHING;
+
+-- name: GetEnclosuresForPosts :many
+SELECT * FROM post_enclosures
+WHERE post_id = ANY(sqlc.arg(post_ids)::uuid[])
+ORDER BY created_at;
+
+-- name: GetCategoriesForPosts :many
+SELECT * FROM post_categories
+WHERE post_id = ANY(sqlc.arg(post_ids)::uuid[])
+ORDER BY name;
+
+-- name: MovePostsToFeed :exec
+-- Used when merging feeds. Posts the target already has (same guid) stay
+-- behind and go away with the source feed.
+UPDATE posts
+SET feed_id = sqlc.arg(to_feed_id), updated_at = NOW()
+WHERE feed_id = sqlc.arg(from_feed_id)
+AND guid NOT IN (SELECT guid FROM posts WHERE feed_id = sqlc.arg(to_feed_id));
@@ -0,0 +1,74 @@
+-- name: CountPrunablePosts :many
+-- What DeletePrunablePosts would delete, per feed. A post goes once it was
+-- published more than keep_days ago or isn't among the keep_posts latest of
+-- its feed, unless it was published or stored less than floor_seconds ago.
+-- keep_* come from the feed's policy or the global one, 0 = no limit.
+SELECT p.feed_id, COUNT(*) AS posts
+FROM (
+    SELECT posts.feed_id, posts.published_at, posts.created_at,
+    row_number() OVER (PARTITION BY posts.feed_id ORDER BY posts.published_at DESC, posts.id) AS position
+    FROM posts
+) p
+LEFT JOIN feed_retention_policies policy ON policy.feed_id = p.feed_id
+WHERE p.published_at < NOW() - (sqlc.arg(floor_seconds)::bigint * interval '1 second')
+AND p.created_at < NOW() - (sqlc.arg(floor_seconds)::bigint * interval '1 second')
+AND (
+    (COALESCE(policy.keep_days, sqlc.arg(keep_days)::integer) > 0
+        AND p.published_at < NOW() - (COALESCE(policy.keep_days, sqlc.arg(keep_days)::integer) * interval '1 day'))
+    OR (COALESCE(policy.keep_posts, sqlc.arg(keep_posts)::integer) > 0
+        AND p.position > COALESCE(policy.keep_posts, sqlc.arg(keep_posts)::integer))
+)
+GROUP BY p.feed_id
+ORDER BY posts DESC, p.feed_id;
+
+-- name: DeletePrunablePosts :execrows
+-- One batch of what CountPrunablePosts counts for the feed, repeat until it
+-- deletes nothing. Small batches keep the locks short.
+DELETE FROM posts
+WHERE id IN (
+    SELECT p.id
+    FROM (
+        SELECT posts.id, posts.published_at, posts.created_at,
+        row_number() OVER (ORDER BY posts.published_at DESC, posts.id) AS position
+        FROM posts
+        WHERE posts.feed_id = sqlc.arg(feed_id)
+    ) p
+    LEFT JOIN feed_retention_policies policy ON policy.feed_id = sqlc.arg(feed_id)
+    WHERE p.published_at < NOW() - (sqlc.arg(floor_seconds)::bigint * interval '1 second')
+    AND p.created_at < NOW() - (sqlc.arg(floor_seconds)::bigint * interval '1 second')
+    AND (
+        (COALESCE(policy.keep_days, sqlc.arg(keep_days)::integer) > 0
+            AND p.published_at < NOW() - (COALESCE(policy.keep_days, sqlc.arg(keep_days)::integer) * interval '1 day'))
+        OR (COALESCE(policy.keep_posts, sqlc.arg(keep_posts)::integer) > 0
+            AND p.position > COALESCE(policy.keep_posts, sqlc.arg(keep_posts)::integer))
+    )
+    LIMIT sqlc.arg(batch_size)
+);
+
+-- name: UpsertFeedRetentionPolicy :one
+INSERT INTO feed_retention_policies (feed_id, keep_days, keep_posts)
+VALUES ($1, $2, $3)
+ON CONFLICT (feed_id) DO UPDATE
+SET keep_days = EXCLUDED.keep_days,
+keep_posts = EXCLUDED.keep_posts,
+updated_at = NOW()
+RETURNING *;
+
+-- name: DeleteFeedRetentionPolicy :execrows
+DELETE FROM feed_retention_policies WHERE feed_id = $1;
+
+-- name: GetFeedRetention :one
+-- The keep_* that apply to the feed, its own policy or the global one.
+SELECT COALESCE(policy.keep_days, sqlc.arg(keep_days)::integer)::integer AS keep_days,
+COALESCE(policy.keep_posts, sqlc.arg(keep_posts)::integer)::integer AS keep_posts
+FROM feeds
+LEFT JOIN feed_retention_policies policy ON policy.feed_id = feeds.id
+WHERE feeds.id = sqlc.arg(feed_id);
+
+-- name: GetNthLatestPostPublishedAt :one
+-- published_at of the feed's post at that rank, newest first (0 is the latest),
+-- the same order as DeletePrunablePosts.
+SELECT published_at FROM posts
+WHERE feed_id = $1
+ORDER BY published_at DESC, id
+OFFSET $2 LIMIT 1;
@@ -0,0 +1,13 @@
+-- name: GetScraperSettings :one
+SELECT * FROM scraper_settings;
+
+-- name: SetScraperPaused :exec
+UPDATE scraper_settings SET paused = $1, updated_at = NOW();
+
+-- name: SetScraperPace :exec
+-- Both in one statement so a request never applies half its changes, NULL
+-- keeps the current value.
+UPDATE scraper_settings
+SET concurrency = COALESCE(sqlc.narg(concurrency), concurrency),
+    interval_seconds = COALESCE(sqlc.narg(interval_seconds), interval_seconds),
+    updated_at = NOW();
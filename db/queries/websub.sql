@@ -0,0 +1,54 @@
+-- name: GetWebsubSubscription :one
+-- Ages are computed here so they use the database clock like the timestamps.
+SELECT *,
+COALESCE(EXTRACT(EPOCH FROM lease_expires_at - NOW()), 0)::bigint AS lease_remaining_seconds,
+EXTRACT(EPOCH FROM NOW() - updated_at)::bigint AS requested_seconds_ago
+FROM websub_subscriptions
+WHERE feed_id = $1;
+
+-- name: UpsertWebsubSubscription :exec
+-- Records a subscribe request. Renewing an active subscription (same hub and
+-- topic) keeps it subscribed until the hub verifies the renewal.
+INSERT INTO websub_subscriptions (feed_id, hub_url, topic_url, secret)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (feed_id) DO UPDATE
+SET state = CASE
+    WHEN websub_subscriptions.state = 'subscribed'
+        AND websub_subscriptions.hub_url = EXCLUDED.hub_url
+        AND websub_subscriptions.topic_url = EXCLUDED.topic_url
+    THEN 'subscribed'
+    ELSE 'pending'
+END,
+hub_url = EXCLUDED.hub_url,
+topic_url = EXCLUDED.topic_url,
+secret = EXCLUDED.secret,
+updated_at = NOW();
+
+-- name: ConfirmWebsubSubscription :execrows
+-- The hub verified our intent, it pushes until lease_expires_at. Only a request
+-- we're waiting on can be verified: a pending subscription, or a renewal asked
+-- for within the last hour (updated_at after the last verification, which sets
+-- it to lease_expires_at - lease_seconds). Anything else is a replayed or
+-- forged verification extending a lease we never asked for.
+UPDATE websub_subscriptions
+SET state = 'subscribed',
+lease_seconds = sqlc.arg(lease_seconds)::integer,
+lease_expires_at = NOW() + (sqlc.arg(lease_seconds)::integer * interval '1 second'),
+updated_at = NOW()
+WHERE feed_id = sqlc.arg(feed_id) AND topic_url = sqlc.arg(topic_url)
+AND (
+    state = 'pending'
+    OR (
+        state = 'subscribed'
+        AND updated_at > NOW() - interval '1 hour'
+        AND updated_at > lease_expires_at - (lease_seconds * interval '1 second')
+    )
+);
+
+-- name: DenyWebsubSubscription :execrows
+UPDATE websub_subscriptions
+SET state = 'denied',
+lease_seconds = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE feed_id = $1 AND topic_url = $2;
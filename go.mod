@@ -10,3 +10,7 @@ require (
 )
 
 require github.com/lib/pq v1.10.9
+
+require golang.org/x/net v0.50.0
+
+require golang.org/x/text v0.34.0
@@ -2,8 +2,11 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
+	"github.com/alepaez-dev/rss_aggregator/internal/tasks"
 	"github.com/google/uuid"
 )
 
@@ -12,12 +15,44 @@ type DB interface {
 	GetUserByAPIKey(ctx context.Context, apiKey string) (database.User, error)
 	CreateFeed(ctx context.Context, arg database.CreateFeedParams) (database.Feed, error)
 	GetFeeds(ctx context.Context) ([]database.Feed, error)
+	GetFeedByID(ctx context.Context, id uuid.UUID) (database.Feed, error)
+	GetOverdueFeedStats(ctx context.Context) (database.GetOverdueFeedStatsRow, error)
+	GetFeedFetch(ctx context.Context, id uuid.UUID) (database.FeedFetch, error)
+	GetFeedFetches(ctx context.Context, arg database.GetFeedFetchesParams) ([]database.FeedFetch, error)
 	CreateFeedFollow(ctx context.Context, arg database.CreateFeedFollowParams) (database.FeedFollow, error)
-	GetFeedFollows(ctx context.Context, userID uuid.UUID) ([]database.FeedFollow, error)
+	GetFeedFollows(ctx context.Context, userID uuid.UUID) ([]database.GetFeedFollowsRow, error)
 	DeleteFeedFollow(ctx context.Context, arg database.DeleteFeedFollowParams) (int64, error)
 	GetPostsForUser(ctx context.Context, arg database.GetPostsForUserParams) ([]database.Post, error)
+	GetEnclosuresForPosts(ctx context.Context, postIds []uuid.UUID) ([]database.PostEnclosure, error)
+	GetCategoriesForPosts(ctx context.Context, postIds []uuid.UUID) ([]database.PostCategory, error)
+	GetPostByID(ctx context.Context, id uuid.UUID) (database.Post, error)
+	GetPostRevisions(ctx context.Context, postID uuid.UUID) ([]database.PostRevision, error)
+	GetWebsubSubscription(ctx context.Context, feedID uuid.UUID) (database.GetWebsubSubscriptionRow, error)
+	ConfirmWebsubSubscription(ctx context.Context, arg database.ConfirmWebsubSubscriptionParams) (int64, error)
+	DenyWebsubSubscription(ctx context.Context, arg database.DenyWebsubSubscriptionParams) (int64, error)
+	UpsertFeedRetentionPolicy(ctx context.Context, arg database.UpsertFeedRetentionPolicyParams) (database.FeedRetentionPolicy, error)
+	DeleteFeedRetentionPolicy(ctx context.Context, feedID uuid.UUID) (int64, error)
+}
+
+// Scraper is the running scraper (tasks.Scraper): refreshes and admin controls.
+type Scraper interface {
+	Refresh(ctx context.Context, feedID uuid.UUID, wait time.Duration) (jobID uuid.UUID, done bool, err error)
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+	SetPace(ctx context.Context, concurrency *int, interval *time.Duration) error
+	Status() tasks.ScraperStatus
+}
+
+// Pruner is the post retention (tasks.Pruner), for the admin dry-run.
+type Pruner interface {
+	Policy() tasks.RetentionPolicy
+	DryRun(ctx context.Context) ([]database.CountPrunablePostsRow, error)
 }
 
 type ApiConfig struct {
-	DB DB
+	DB      DB
+	Scraper Scraper
+	Pruner  Pruner
+	// stores the posts a WebSub hub pushed, same path as polling (tasks.IngestPushedFeed)
+	IngestPushedFeed func(ctx context.Context, feedID uuid.UUID, parsed feeds.Feed) error
 }
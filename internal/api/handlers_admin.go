@@ -0,0 +1,179 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/alepaez-dev/rss_aggregator/internal/tasks"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+)
+
+// Scraper controls, to slow down or stop ingestion live (publisher outage,
+// database maintenance). They're shared by every instance: the one serving the
+// request applies them right away, the others on their next tick. The status
+// returned is the serving instance's.
+
+func (cfg *ApiConfig) handlerGetScraperStatus(w http.ResponseWriter, r *http.Request, user database.User) {
+	respondWithJSON(w, http.StatusOK, scraperStatusToScraperStatus(cfg.Scraper.Status()))
+}
+
+// In-flight jobs finish, nothing new is claimed until resumed.
+func (cfg *ApiConfig) handlerPauseScraper(w http.ResponseWriter, r *http.Request, user database.User) {
+	if err := cfg.Scraper.Pause(r.Context()); err != nil {
+		log.Printf("Error pausing scraper: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't pause scraper")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, scraperStatusToScraperStatus(cfg.Scraper.Status()))
+}
+
+func (cfg *ApiConfig) handlerResumeScraper(w http.ResponseWriter, r *http.Request, user database.User) {
+	if err := cfg.Scraper.Resume(r.Context()); err != nil {
+		log.Printf("Error resuming scraper: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't resume scraper")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, scraperStatusToScraperStatus(cfg.Scraper.Status()))
+}
+
+// Changes the settings given, the others stay as they are. Applied in order,
+// concurrency first.
+func (cfg *ApiConfig) handlerUpdateScraper(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		Concurrency     *int `json:"concurrency"`
+		IntervalSeconds *int `json:"interval_seconds"`
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error parsing JSON: %v", err))
+		return
+	}
+
+	var interval *time.Duration
+	if params.IntervalSeconds != nil {
+		d := time.Duration(*params.IntervalSeconds) * time.Second
+		interval = &d
+	}
+	err = cfg.Scraper.SetPace(r.Context(), params.Concurrency, interval)
+	if !respondToScraperSettingError(w, err) {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, scraperStatusToScraperStatus(cfg.Scraper.Status()))
+}
+
+// respondToScraperSettingError answers the errors of a scraper setter, false
+// when it did. Out of range values are the client's fault, anything else is
+// the database's.
+func respondToScraperSettingError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, tasks.ErrInvalidSetting):
+		respondWithError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("Error updating scraper settings: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update scraper settings")
+	}
+	return false
+}
+
+// Post retention. Pruning runs as a background job, these let admins check
+// what it would delete and tune it per feed (high-volume feeds nobody reads).
+
+func (cfg *ApiConfig) handlerRetentionDryRun(w http.ResponseWriter, r *http.Request, user database.User) {
+	counts, err := cfg.Pruner.DryRun(r.Context())
+	if err != nil {
+		log.Printf("Error counting prunable posts: %v", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't count prunable posts")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, retentionDryRunToRetentionDryRun(cfg.Pruner.Policy(), counts))
+}
+
+// Replaces the feed's policy, a null or missing value keeps the global one
+// and 0 means no limit.
+func (cfg *ApiConfig) handlerSetFeedRetention(w http.ResponseWriter, r *http.Request, user database.User) {
+	type parameters struct {
+		KeepDays  *int32 `json:"keep_days"`
+		KeepPosts *int32 `json:"keep_posts"`
+	}
+
+	feedID, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid feed ID")
+		return
+	}
+
+	params := parameters{}
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Error parsing JSON: %v", err))
+		return
+	}
+	if (params.KeepDays != nil && *params.KeepDays < 0) || (params.KeepPosts != nil && *params.KeepPosts < 0) {
+		respondWithError(w, http.StatusBadRequest, "keep_days and keep_posts can't be negative")
+		return
+	}
+
+	_, err = cfg.DB.GetFeedByID(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting feed %v: error=%v", feedID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get feed")
+		return
+	}
+
+	policy := database.UpsertFeedRetentionPolicyParams{FeedID: feedID}
+	if params.KeepDays != nil {
+		policy.KeepDays = sql.NullInt32{Int32: *params.KeepDays, Valid: true}
+	}
+	if params.KeepPosts != nil {
+		policy.KeepPosts = sql.NullInt32{Int32: *params.KeepPosts, Valid: true}
+	}
+	dbPolicy, err := cfg.DB.UpsertFeedRetentionPolicy(r.Context(), policy)
+	if err != nil {
+		log.Printf("Error setting retention of feed %v: error=%v", feedID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't set feed retention")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseFeedRetentionPolicyToFeedRetentionPolicy(dbPolicy))
+}
+
+// Back to the global policy.
+func (cfg *ApiConfig) handlerDeleteFeedRetention(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid feed ID")
+		return
+	}
+
+	deleted, err := cfg.DB.DeleteFeedRetentionPolicy(r.Context(), feedID)
+	if err != nil {
+		log.Printf("Error deleting retention of feed %v: error=%v", feedID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't delete feed retention")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
@@ -1,16 +1,31 @@
 package api
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/alepaez-dev/rss_aggregator/internal/database"
 	"github.com/alepaez-dev/rss_aggregator/internal/dberr"
+	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
+	"github.com/alepaez-dev/rss_aggregator/internal/tasks"
+	"github.com/go-chi/chi"
 	"github.com/google/uuid"
 )
 
+const discoverTimeout = 15 * time.Second
+
+type multipleFeedsResp struct {
+	Error      string          `json:"error"`
+	Candidates []FeedCandidate `json:"candidates"`
+}
+
 func (cfg *ApiConfig) handlerCreateFeed(w http.ResponseWriter, r *http.Request, user database.User) {
 	type parameters struct {
 		Name string `json:"name"`
@@ -25,10 +40,42 @@ func (cfg *ApiConfig) handlerCreateFeed(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	if err := feeds.ValidateURL(params.Url); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid feed URL: %v", err))
+		return
+	}
+
+	// Users paste blog homepages all the time, store the feed behind it instead.
+	// That means the URL has to answer now, a feed that's down can't be
+	// created (400) until it's back: we can't tell a page from a feed without
+	// fetching it, and a URL that doesn't answer on creation is far more often
+	// a typo than an outage. The client can retry.
+	discoverCtx, cancel := context.WithTimeout(r.Context(), discoverTimeout)
+	defer cancel()
+
+	candidates, err := feeds.Discover(discoverCtx, params.Url)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fetchErrorMessage("Couldn't fetch feed URL", err))
+		return
+	}
+
+	switch len(candidates) {
+	case 0:
+		respondWithError(w, http.StatusUnprocessableEntity, "No feed found at this URL")
+		return
+	case 1: // the URL itself or the only feed the page advertises
+	default:
+		respondWithJSON(w, http.StatusMultipleChoices, multipleFeedsResp{
+			Error:      "More than one feed found at this URL, pick one",
+			Candidates: feedCandidatesToFeedCandidates(candidates),
+		})
+		return
+	}
+
 	feed, err := cfg.DB.CreateFeed(r.Context(), database.CreateFeedParams{
 		ID:     uuid.New(),
 		Name:   params.Name,
-		Url:    params.Url,
+		Url:    candidates[0].URL,
 		UserID: user.ID,
 	})
 
@@ -43,6 +90,8 @@ func (cfg *ApiConfig) handlerCreateFeed(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
+	cfg.fetchNewFeed(feed.ID)
+
 	respondWithJSON(
 		w,
 		http.StatusCreated,
@@ -65,3 +114,162 @@ func (cfg *ApiConfig) handlerGetFeeds(w http.ResponseWriter, r *http.Request) {
 		databaseFeedsToFeed(feeds),
 	)
 }
+
+// Finds the feeds behind a page URL without creating anything
+func (cfg *ApiConfig) handlerDiscoverFeeds(w http.ResponseWriter, r *http.Request, user database.User) {
+	pageURL := r.URL.Query().Get("url")
+	if pageURL == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing url query param")
+		return
+	}
+	if err := feeds.ValidateURL(pageURL); err != nil {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid URL: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), discoverTimeout)
+	defer cancel()
+
+	candidates, err := feeds.Discover(ctx, pageURL)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, fetchErrorMessage("Couldn't fetch URL", err))
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, feedCandidatesToFeedCandidates(candidates))
+}
+
+// fetchErrorMessage tells the client why a URL couldn't be fetched. Blocked
+// URLs only get ErrBlockedURL's message, whatever the dialer found out about
+// our network is none of their business.
+func fetchErrorMessage(prefix string, err error) string {
+	if errors.Is(err, feeds.ErrBlockedURL) {
+		return fmt.Sprintf("%s: %v", prefix, feeds.ErrBlockedURL)
+	}
+	return fmt.Sprintf("%s: %v", prefix, err)
+}
+
+const (
+	defaultFetchesLimit = 20
+	maxFetchesLimit     = 50 // what the scraper keeps per feed anyway
+)
+
+// Latest scrape runs of a feed, newest first. What to look at when a feed
+// stopped updating.
+func (cfg *ApiConfig) handlerGetFeedFetches(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid feed ID")
+		return
+	}
+
+	limit := defaultFetchesLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsedLimit, err := strconv.Atoi(limitParam)
+		if err != nil || parsedLimit <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = min(parsedLimit, maxFetchesLimit)
+	}
+
+	_, err = cfg.DB.GetFeedByID(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting feed %v: error=%v", feedID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get feed")
+		return
+	}
+
+	fetches, err := cfg.DB.GetFeedFetches(r.Context(), database.GetFeedFetchesParams{
+		FeedID: feedID,
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		log.Printf("Error getting fetches for feed %v: error=%v", feedID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get feed fetches")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseFeedFetchesToFeedFetches(fetches))
+}
+
+// A refresh usually completes within that, otherwise the client gets the job
+// ID and finds the run in the feed's fetches later.
+const refreshWait = 25 * time.Second
+
+type feedRefreshResp struct {
+	JobID uuid.UUID `json:"job_id"`
+}
+
+// Scrapes the feed now instead of waiting for its turn. Answers with the run
+// when it's done in time, 202 and the job ID (= fetch ID) otherwise.
+func (cfg *ApiConfig) handlerRefreshFeed(w http.ResponseWriter, r *http.Request, user database.User) {
+	feedID, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid feed ID")
+		return
+	}
+
+	feed, err := cfg.DB.GetFeedByID(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting feed %v: error=%v", feedID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get feed")
+		return
+	}
+	if feed.Status != "active" || feed.DisabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Feed is not scraped anymore")
+		return
+	}
+
+	jobID, done, err := cfg.Scraper.Refresh(r.Context(), feedID, refreshWait)
+	switch {
+	case errors.Is(err, tasks.ErrFeedBusy):
+		respondWithError(w, http.StatusConflict, "Feed is being scraped, try again shortly")
+		return
+	case errors.Is(err, tasks.ErrScraperPaused):
+		respondWithError(w, http.StatusServiceUnavailable, "Scraping is paused, try again later")
+		return
+	case errors.Is(err, tasks.ErrRefreshQueueFull):
+		respondWithError(w, http.StatusServiceUnavailable, "Too many refreshes, try again shortly")
+		return
+	case err != nil:
+		log.Printf("Error refreshing feed %v: error=%v", feedID, err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't refresh feed")
+		return
+	}
+
+	if !done {
+		respondWithJSON(w, http.StatusAccepted, feedRefreshResp{JobID: jobID})
+		return
+	}
+
+	fetch, err := cfg.DB.GetFeedFetch(r.Context(), jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// no run recorded: the feed got merged into the one it redirects to
+		respondWithError(w, http.StatusNotFound, "Feed moved")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting fetch %v: error=%v", jobID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get feed fetch")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databaseFeedFetchToFeedFetch(fetch))
+}
+
+// fetchNewFeed queues the first fetch of a feed so its posts show up right
+// away, best effort: the ticker gets to it anyway.
+func (cfg *ApiConfig) fetchNewFeed(feedID uuid.UUID) {
+	if _, _, err := cfg.Scraper.Refresh(context.Background(), feedID, 0); err != nil {
+		log.Printf("Couldn't queue first fetch of feed %v: %v", feedID, err)
+	}
+}
@@ -43,6 +43,14 @@ func (cfg *ApiConfig) handlerCreateFeedFollow(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// nothing to show yet when the feed was never scraped successfully
+	feed, err := cfg.DB.GetFeedByID(r.Context(), feedFollow.FeedID)
+	if err != nil {
+		log.Printf("Error getting feed %v: %v", feedFollow.FeedID, err)
+	} else if !feed.LastSuccessAt.Valid {
+		cfg.fetchNewFeed(feed.ID)
+	}
+
 	respondWithJSON(
 		w,
 		http.StatusCreated,
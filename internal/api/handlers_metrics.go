@@ -0,0 +1,35 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/metrics"
+)
+
+var (
+	feedsOverdue = metrics.NewGauge("rss_feeds_overdue",
+		"Feeds due for a fetch that no scraper claimed yet.")
+	feedsMaxDelay = metrics.NewGauge("rss_feeds_overdue_max_delay_seconds",
+		"How late the most overdue feed is.")
+)
+
+// Prometheus scrape endpoint. Scraper metrics are kept in memory by the
+// workers, the overdue feeds come from the database so they cover every
+// instance.
+func (cfg *ApiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+	overdue, err := cfg.DB.GetOverdueFeedStats(r.Context())
+	if err != nil {
+		// the rest is still worth serving, the gauges keep their last value
+		log.Printf("Error getting overdue feeds: %v", err)
+	} else {
+		feedsOverdue.Set(float64(overdue.Overdue))
+		feedsMaxDelay.Set(float64(overdue.MaxDelaySeconds))
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := metrics.Write(w); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+)
+
+// Previous versions of a post, newest first. The current version is the post itself.
+func (cfg *ApiConfig) handlerGetPostRevisions(w http.ResponseWriter, r *http.Request, user database.User) {
+	postID, err := uuid.Parse(chi.URLParam(r, "postID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid post ID")
+		return
+	}
+
+	_, err = cfg.DB.GetPostByID(r.Context(), postID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting post %v: error=%v", postID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get post")
+		return
+	}
+
+	revisions, err := cfg.DB.GetPostRevisions(r.Context(), postID)
+	if err != nil {
+		log.Printf("Error getting revisions for post %v: error=%v", postID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get post revisions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databasePostRevisionsToPostRevisions(revisions))
+}
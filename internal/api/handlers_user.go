@@ -86,5 +86,24 @@ func (cfg *ApiConfig) handlerGetPostsForUser(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, databasePostsToPosts(posts))
+	postIDs := make([]uuid.UUID, len(posts))
+	for i, post := range posts {
+		postIDs[i] = post.ID
+	}
+
+	enclosures, err := cfg.DB.GetEnclosuresForPosts(r.Context(), postIDs)
+	if err != nil {
+		log.Printf("Couldn't get enclosures for posts: %v", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get post for user")
+		return
+	}
+
+	categories, err := cfg.DB.GetCategoriesForPosts(r.Context(), postIDs)
+	if err != nil {
+		log.Printf("Couldn't get categories for posts: %v", err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't get post for user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, databasePostsToPosts(posts, enclosures, categories))
 }
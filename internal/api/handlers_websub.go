@@ -0,0 +1,155 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
+	"github.com/alepaez-dev/rss_aggregator/internal/tasks"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+)
+
+// same order of magnitude as what the scraper accepts when polling
+const maxWebSubPushSize = 10 << 20
+
+// WebSub callbacks, called by hubs not users so there's no auth: the topic
+// must match our pending subscription and pushes must be signed with its secret.
+
+// The hub checks we really asked for the subscription (verification of
+// intent), we confirm by echoing hub.challenge.
+func (cfg *ApiConfig) handlerWebSubVerify(w http.ResponseWriter, r *http.Request) {
+	feedID, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Unknown subscription")
+		return
+	}
+
+	query := r.URL.Query()
+	topic := query.Get("hub.topic")
+
+	switch query.Get("hub.mode") {
+	case "subscribe":
+		leaseSeconds, err := strconv.Atoi(query.Get("hub.lease_seconds"))
+		if err != nil || leaseSeconds <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid hub.lease_seconds")
+			return
+		}
+		// never more than we asked for, also keeps it within the int32 column
+		leaseSeconds = min(leaseSeconds, int(tasks.WebSubLease.Seconds()))
+
+		rows, err := cfg.DB.ConfirmWebsubSubscription(r.Context(), database.ConfirmWebsubSubscriptionParams{
+			LeaseSeconds: int32(leaseSeconds),
+			FeedID:       feedID,
+			TopicUrl:     topic,
+		})
+		if err != nil {
+			log.Printf("Error confirming WebSub subscription of feed %v: error=%v", feedID, err)
+			respondWithError(w, http.StatusBadRequest, "Couldn't confirm subscription")
+			return
+		}
+		if rows == 0 {
+			respondWithError(w, http.StatusNotFound, "Unknown subscription")
+			return
+		}
+
+		log.Printf("WebSub subscription of feed %v verified, lease %ds", feedID, leaseSeconds)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(query.Get("hub.challenge")))
+
+	case "denied":
+		_, err := cfg.DB.DenyWebsubSubscription(r.Context(), database.DenyWebsubSubscriptionParams{
+			FeedID:   feedID,
+			TopicUrl: topic,
+		})
+		if err != nil {
+			log.Printf("Error denying WebSub subscription of feed %v: error=%v", feedID, err)
+			respondWithError(w, http.StatusBadRequest, "Couldn't deny subscription")
+			return
+		}
+
+		log.Printf("WebSub subscription of feed %v denied: %s", feedID, query.Get("hub.reason"))
+		w.WriteHeader(http.StatusOK)
+
+	default: // we never unsubscribe, whoever asks it's not on our behalf
+		respondWithError(w, http.StatusNotFound, "Unknown subscription")
+	}
+}
+
+// The hub pushes new content of the feed. Goes through the same ingestion as
+// polling once the signature checks out. Pushes for a subscription that isn't
+// confirmed, or a feed we don't scrape anymore, get a 410 so the hub stops.
+func (cfg *ApiConfig) handlerWebSubPush(w http.ResponseWriter, r *http.Request) {
+	feedID, err := uuid.Parse(chi.URLParam(r, "feedID"))
+	if err != nil {
+		respondWithError(w, http.StatusGone, "Unknown subscription")
+		return
+	}
+
+	sub, err := cfg.DB.GetWebsubSubscription(r.Context(), feedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusGone, "Unknown subscription") // tells the hub to stop
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting WebSub subscription of feed %v: error=%v", feedID, err)
+		// 5xx so the hub retries later, a 4xx could make it drop us
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get subscription")
+		return
+	}
+	if sub.State != "subscribed" {
+		respondWithError(w, http.StatusGone, "Unknown subscription")
+		return
+	}
+
+	feed, err := cfg.DB.GetFeedByID(r.Context(), feedID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting feed %v: error=%v", feedID, err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get feed")
+		return
+	}
+	// we don't poll dead or disabled feeds, pushes for them aren't wanted either
+	if err != nil || feed.Status != "active" || feed.DisabledAt.Valid {
+		respondWithError(w, http.StatusGone, "Unknown subscription")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebSubPushSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read body")
+		return
+	}
+	if len(body) > maxWebSubPushSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Body too large")
+		return
+	}
+
+	if !feeds.VerifySignature(r.Header.Get("X-Hub-Signature"), sub.Secret, body) {
+		// the spec wants a 2xx anyway so forgers can't tell, we just ignore it
+		log.Printf("WebSub push for feed %v with invalid signature, ignored", feedID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	parsed, err := feeds.Parse(body, r.Header.Get("Content-Type"))
+	if err != nil {
+		log.Printf("Error parsing WebSub push for feed %v: error=%v", feedID, err)
+		respondWithError(w, http.StatusBadRequest, "Couldn't parse feed")
+		return
+	}
+
+	if err := cfg.IngestPushedFeed(r.Context(), feedID, parsed); err != nil {
+		log.Printf("Error ingesting WebSub push for feed %v: error=%v", feedID, err)
+		// 5xx so the hub retries later
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store posts")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
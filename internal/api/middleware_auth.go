@@ -27,3 +27,15 @@ func (cfg *ApiConfig) middlewareAuth(handler authedHandler) http.HandlerFunc {
 		handler(w, r, user)
 	}
 }
+
+// middlewareAdmin is middlewareAuth for admins only (users.is_admin).
+func (cfg *ApiConfig) middlewareAdmin(handler authedHandler) http.HandlerFunc {
+	return cfg.middlewareAuth(func(w http.ResponseWriter, r *http.Request, user database.User) {
+		if !user.IsAdmin {
+			respondWithError(w, http.StatusForbidden, "Admins only")
+			return
+		}
+
+		handler(w, r, user)
+	})
+}
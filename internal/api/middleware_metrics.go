@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/metrics"
+	"github.com/go-chi/chi"
+)
+
+var (
+	httpRequests = metrics.NewCounter("rss_http_requests_total",
+		"API requests by method, route pattern and status.", "method", "route", "status")
+	httpRequestDuration = metrics.NewHistogram("rss_http_request_duration_seconds",
+		"API request latencies by method and route pattern.", metrics.DefaultBuckets, "method", "route")
+)
+
+// statusRecorder remembers the status the handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// middlewareMetrics counts requests per route pattern (/v1/feeds/{feedID}/...)
+// rather than path, one series per feed ID would be too many.
+func middlewareMetrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		next.ServeHTTP(rec, r)
+
+		// only known once chi routed the request
+		route := chi.RouteContext(r.Context()).RoutePattern()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.Inc(r.Method, route, strconv.Itoa(rec.status))
+		httpRequestDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
+	"github.com/alepaez-dev/rss_aggregator/internal/tasks"
 	"github.com/google/uuid"
 )
 
@@ -16,12 +19,74 @@ type User struct {
 }
 
 type Feed struct {
-	ID        uuid.UUID `json:"id"`
+	ID                  uuid.UUID  `json:"id"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	Name                string     `json:"name"`
+	Url                 string     `json:"url"`
+	UserID              uuid.UUID  `json:"user_id"`
+	LastFetchedAt       *time.Time `json:"last_fetched_at"`
+	LastSuccessAt       *time.Time `json:"last_success_at"`
+	ConsecutiveFailures int32      `json:"consecutive_failures"`
+	LastError           *string    `json:"last_error"`
+	LastErrorAt         *time.Time `json:"last_error_at"`
+	DisabledAt          *time.Time `json:"disabled_at"`
+	ThrottledUntil      *time.Time `json:"throttled_until"`
+	Status              string     `json:"status"`
+}
+
+// One scrape run of a feed
+type FeedFetch struct {
+	ID            uuid.UUID `json:"id"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	DurationMs    int64     `json:"duration_ms"`
+	HttpStatus    *int32    `json:"http_status"`
+	Bytes         int64     `json:"bytes"`
+	ItemsSeen     int32     `json:"items_seen"`
+	PostsInserted int32     `json:"posts_inserted"`
+	PostsUpdated  int32     `json:"posts_updated"`
+	PostsSkipped  int32     `json:"posts_skipped"`
+	Error         *string   `json:"error"`
+}
+
+type ScraperStatus struct {
+	InstanceID      string `json:"instance_id"`
+	Running         bool   `json:"running"`
+	Paused          bool   `json:"paused"`
+	Concurrency     int    `json:"concurrency"`
+	BusyWorkers     int    `json:"busy_workers"`
+	IntervalSeconds int    `json:"interval_seconds"`
+	QueuedRefreshes int    `json:"queued_refreshes"`
+}
+
+// Per feed overrides of the global retention, null keeps the global value
+type FeedRetentionPolicy struct {
+	FeedID    uuid.UUID `json:"feed_id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
-	Name      string    `json:"name"`
-	Url       string    `json:"url"`
-	UserID    uuid.UUID `json:"user_id"`
+	KeepDays  *int32    `json:"keep_days"`
+	KeepPosts *int32    `json:"keep_posts"`
+}
+
+// What pruning would delete right now, with the global policy it applies
+type RetentionDryRun struct {
+	KeepDays  int              `json:"keep_days"`
+	KeepPosts int              `json:"keep_posts"`
+	FloorDays int              `json:"floor_days"`
+	Posts     int64            `json:"posts"`
+	Feeds     []FeedPruneCount `json:"feeds"`
+}
+
+type FeedPruneCount struct {
+	FeedID uuid.UUID `json:"feed_id"`
+	Posts  int64     `json:"posts"`
+}
+
+type FeedCandidate struct {
+	Url   string `json:"url"`
+	Title string `json:"title"`
+	Type  string `json:"type"`
 }
 
 type FeedFollow struct {
@@ -30,17 +95,40 @@ type FeedFollow struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	UserID    uuid.UUID `json:"user_id"`
 	FeedID    uuid.UUID `json:"feed_id"`
+	// "active" or "dead" when the feed is gone, only when listing follows
+	FeedStatus string `json:"feed_status,omitempty"`
 }
 
 type Post struct {
+	ID          uuid.UUID   `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	Title       string      `json:"title"`
+	Description *string     `json:"description"`
+	Content     *string     `json:"content"`
+	Author      *string     `json:"author"`
+	CommentsUrl *string     `json:"comments_url"`
+	ImageUrl    *string     `json:"image_url"`
+	PublishedAt time.Time   `json:"published_at"`
+	Url         string      `json:"url"`
+	FeedID      uuid.UUID   `json:"feed_id"`
+	Guid        string      `json:"guid"`
+	Enclosures  []Enclosure `json:"enclosures"`
+	Categories  []string    `json:"categories"`
+}
+
+type PostRevision struct {
 	ID          uuid.UUID `json:"id"`
 	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	PostID      uuid.UUID `json:"post_id"`
 	Title       string    `json:"title"`
 	Description *string   `json:"description"`
-	PublishedAt time.Time `json:"published_at"`
-	Url         string    `json:"url"`
-	FeedID      uuid.UUID `json:"feed_id"`
+}
+
+type Enclosure struct {
+	Url      string  `json:"url"`
+	MimeType *string `json:"mime_type"`
+	Length   *int64  `json:"length"`
 }
 
 func databaseUserToUser(dbUser database.User) User {
@@ -55,12 +143,20 @@ func databaseUserToUser(dbUser database.User) User {
 
 func databaseFeedToFeed(dbFeed database.Feed) Feed {
 	return Feed{
-		ID:        dbFeed.ID,
-		CreatedAt: dbFeed.CreatedAt,
-		UpdatedAt: dbFeed.UpdatedAt,
-		Name:      dbFeed.Name,
-		Url:       dbFeed.Url,
-		UserID:    dbFeed.UserID,
+		ID:                  dbFeed.ID,
+		CreatedAt:           dbFeed.CreatedAt,
+		UpdatedAt:           dbFeed.UpdatedAt,
+		Name:                dbFeed.Name,
+		Url:                 dbFeed.Url,
+		UserID:              dbFeed.UserID,
+		LastFetchedAt:       nullTimeToPtr(dbFeed.LastFetchedAt),
+		LastSuccessAt:       nullTimeToPtr(dbFeed.LastSuccessAt),
+		ConsecutiveFailures: dbFeed.ConsecutiveFailures,
+		LastError:           nullStringToPtr(dbFeed.LastError),
+		LastErrorAt:         nullTimeToPtr(dbFeed.LastErrorAt),
+		DisabledAt:          nullTimeToPtr(dbFeed.DisabledAt),
+		ThrottledUntil:      nullTimeToPtr(dbFeed.ThrottledUntil),
+		Status:              dbFeed.Status,
 	}
 }
 
@@ -72,6 +168,46 @@ func databaseFeedsToFeed(dbFeeds []database.Feed) []Feed {
 	return feeds
 }
 
+func databaseFeedFetchToFeedFetch(dbFetch database.FeedFetch) FeedFetch {
+	var httpStatus *int32
+	if dbFetch.HttpStatus.Valid {
+		httpStatus = &dbFetch.HttpStatus.Int32
+	}
+	return FeedFetch{
+		ID:            dbFetch.ID,
+		StartedAt:     dbFetch.StartedAt,
+		FinishedAt:    dbFetch.FinishedAt,
+		DurationMs:    dbFetch.DurationMs,
+		HttpStatus:    httpStatus,
+		Bytes:         dbFetch.Bytes,
+		ItemsSeen:     dbFetch.ItemsSeen,
+		PostsInserted: dbFetch.PostsInserted,
+		PostsUpdated:  dbFetch.PostsUpdated,
+		PostsSkipped:  dbFetch.PostsSkipped,
+		Error:         nullStringToPtr(dbFetch.Error),
+	}
+}
+
+func databaseFeedFetchesToFeedFetches(dbFetches []database.FeedFetch) []FeedFetch {
+	fetches := make([]FeedFetch, len(dbFetches))
+	for i, dbFetch := range dbFetches {
+		fetches[i] = databaseFeedFetchToFeedFetch(dbFetch)
+	}
+	return fetches
+}
+
+func feedCandidatesToFeedCandidates(candidates []feeds.Candidate) []FeedCandidate {
+	feedCandidates := make([]FeedCandidate, len(candidates))
+	for i, candidate := range candidates {
+		feedCandidates[i] = FeedCandidate{
+			Url:   candidate.URL,
+			Title: candidate.Title,
+			Type:  candidate.Type,
+		}
+	}
+	return feedCandidates
+}
+
 func databaseFeedFollowToFeedFollow(dbFeedFollow database.FeedFollow) FeedFollow {
 	return FeedFollow{
 		ID:        dbFeedFollow.ID,
@@ -82,38 +218,154 @@ func databaseFeedFollowToFeedFollow(dbFeedFollow database.FeedFollow) FeedFollow
 	}
 }
 
-func databaseFeedFollowsToFeedFollows(dbFeedFollows []database.FeedFollow) []FeedFollow {
+func databaseFeedFollowsToFeedFollows(dbFeedFollows []database.GetFeedFollowsRow) []FeedFollow {
 	// we know output size, so we make use of it and set from the beginning len and cap
 	// so it doesn't create another underlying array when appending.
 	// dont use append, use index assigment
 	feedFollows := make([]FeedFollow, len(dbFeedFollows))
 	for i, dbFeedFollow := range dbFeedFollows {
-		feedFollows[i] = databaseFeedFollowToFeedFollow(dbFeedFollow)
+		feedFollows[i] = FeedFollow{
+			ID:         dbFeedFollow.ID,
+			CreatedAt:  dbFeedFollow.CreatedAt,
+			UpdatedAt:  dbFeedFollow.UpdatedAt,
+			UserID:     dbFeedFollow.UserID,
+			FeedID:     dbFeedFollow.FeedID,
+			FeedStatus: dbFeedFollow.FeedStatus,
+		}
 	}
 	return feedFollows
 }
 
-func databasePostToPost(dbPost database.Post) Post {
-	var description *string
-	if dbPost.Description.Valid {
-		description = &dbPost.Description.String
+func scraperStatusToScraperStatus(status tasks.ScraperStatus) ScraperStatus {
+	return ScraperStatus{
+		InstanceID:      status.InstanceID,
+		Running:         status.Running,
+		Paused:          status.Paused,
+		Concurrency:     status.Concurrency,
+		BusyWorkers:     status.BusyWorkers,
+		IntervalSeconds: int(status.Interval.Seconds()),
+		QueuedRefreshes: status.QueuedRefreshes,
+	}
+}
+
+func databaseFeedRetentionPolicyToFeedRetentionPolicy(dbPolicy database.FeedRetentionPolicy) FeedRetentionPolicy {
+	return FeedRetentionPolicy{
+		FeedID:    dbPolicy.FeedID,
+		CreatedAt: dbPolicy.CreatedAt,
+		UpdatedAt: dbPolicy.UpdatedAt,
+		KeepDays:  nullInt32ToPtr(dbPolicy.KeepDays),
+		KeepPosts: nullInt32ToPtr(dbPolicy.KeepPosts),
+	}
+}
+
+func retentionDryRunToRetentionDryRun(policy tasks.RetentionPolicy, counts []database.CountPrunablePostsRow) RetentionDryRun {
+	dryRun := RetentionDryRun{
+		KeepDays:  policy.KeepDays,
+		KeepPosts: policy.KeepPosts,
+		FloorDays: int(policy.Floor.Hours() / 24),
+		Feeds:     make([]FeedPruneCount, len(counts)),
+	}
+	for i, count := range counts {
+		dryRun.Posts += count.Posts
+		dryRun.Feeds[i] = FeedPruneCount{FeedID: count.FeedID, Posts: count.Posts}
+	}
+	return dryRun
+}
+
+// NULL → nil so it's null in the JSON instead of ""
+func nullStringToPtr(value sql.NullString) *string {
+	if !value.Valid {
+		return nil
+	}
+	return &value.String
+}
+
+func nullTimeToPtr(value sql.NullTime) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Time
+}
+
+func databaseEnclosureToEnclosure(dbEnclosure database.PostEnclosure) Enclosure {
+	var length *int64
+	if dbEnclosure.Length.Valid {
+		length = &dbEnclosure.Length.Int64
+	}
+	return Enclosure{
+		Url:      dbEnclosure.Url,
+		MimeType: nullStringToPtr(dbEnclosure.MimeType),
+		Length:   length,
+	}
+}
+
+func databasePostToPost(dbPost database.Post, enclosures []Enclosure, categories []string) Post {
+	if enclosures == nil {
+		enclosures = []Enclosure{}
+	}
+	if categories == nil {
+		categories = []string{}
 	}
 	return Post{
 		ID:          dbPost.ID,
 		CreatedAt:   dbPost.CreatedAt,
 		UpdatedAt:   dbPost.UpdatedAt,
 		Title:       dbPost.Title,
-		Description: description,
+		Description: nullStringToPtr(dbPost.Description),
+		Content:     nullStringToPtr(dbPost.Content),
+		Author:      nullStringToPtr(dbPost.Author),
+		CommentsUrl: nullStringToPtr(dbPost.CommentsUrl),
+		ImageUrl:    nullStringToPtr(dbPost.ImageUrl),
 		PublishedAt: dbPost.PublishedAt,
 		Url:         dbPost.Url,
 		FeedID:      dbPost.FeedID,
+		Guid:        dbPost.Guid,
+		Enclosures:  enclosures,
+		Categories:  categories,
 	}
 }
 
-func databasePostsToPosts(dbPosts []database.Post) []Post {
+// enclosures and categories come from their own tables, we group them by post
+// here instead of doing one query per post
+func databasePostsToPosts(
+	dbPosts []database.Post,
+	dbEnclosures []database.PostEnclosure,
+	dbCategories []database.PostCategory,
+) []Post {
+	enclosuresByPost := map[uuid.UUID][]Enclosure{}
+	for _, dbEnclosure := range dbEnclosures {
+		enclosuresByPost[dbEnclosure.PostID] = append(enclosuresByPost[dbEnclosure.PostID], databaseEnclosureToEnclosure(dbEnclosure))
+	}
+
+	categoriesByPost := map[uuid.UUID][]string{}
+	for _, dbCategory := range dbCategories {
+		categoriesByPost[dbCategory.PostID] = append(categoriesByPost[dbCategory.PostID], dbCategory.Name)
+	}
+
 	posts := make([]Post, len(dbPosts))
 	for i, post := range dbPosts {
-		posts[i] = databasePostToPost(post)
+		posts[i] = databasePostToPost(post, enclosuresByPost[post.ID], categoriesByPost[post.ID])
 	}
 	return posts
 }
+
+func databasePostRevisionsToPostRevisions(dbRevisions []database.PostRevision) []PostRevision {
+	revisions := make([]PostRevision, len(dbRevisions))
+	for i, dbRevision := range dbRevisions {
+		revisions[i] = PostRevision{
+			ID:          dbRevision.ID,
+			CreatedAt:   dbRevision.CreatedAt,
+			PostID:      dbRevision.PostID,
+			Title:       dbRevision.Title,
+			Description: nullStringToPtr(dbRevision.Description),
+		}
+	}
+	return revisions
+}
+
+func nullInt32ToPtr(value sql.NullInt32) *int32 {
+	if !value.Valid {
+		return nil
+	}
+	return &value.Int32
+}
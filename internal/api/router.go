@@ -22,6 +22,10 @@ func NewRouter(cfg *ApiConfig) http.Handler {
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
+	r.Use(middlewareMetrics)
+
+	// Prometheus
+	r.Get("/metrics", cfg.handlerMetrics)
 
 	v1Router := chi.NewRouter()
 
@@ -45,12 +49,33 @@ func NewRouter(cfg *ApiConfig) http.Handler {
 	// Feeds
 	v1Router.Post("/feeds", cfg.middlewareAuth(cfg.handlerCreateFeed))
 	v1Router.Get("/feeds", cfg.handlerGetFeeds)
+	v1Router.Get("/feeds/discover", cfg.middlewareAuth(cfg.handlerDiscoverFeeds))
+	v1Router.Get("/feeds/{feedID}/fetches", cfg.middlewareAuth(cfg.handlerGetFeedFetches))
+	v1Router.Post("/feeds/{feedID}/refresh", cfg.middlewareAuth(cfg.handlerRefreshFeed))
+
+	// Posts
+	v1Router.Get("/posts/{postID}/revisions", cfg.middlewareAuth(cfg.handlerGetPostRevisions))
+
+	// WebSub callbacks, called by hubs
+	v1Router.Get("/websub/{feedID}", cfg.handlerWebSubVerify)
+	v1Router.Post("/websub/{feedID}", cfg.handlerWebSubPush)
 
 	// Feeds Follows
 	v1Router.Post("/feed_follows", cfg.middlewareAuth(cfg.handlerCreateFeedFollow))
 	v1Router.Get("/feed_follows", cfg.middlewareAuth(cfg.handlerGetFeedFollows))
 	v1Router.Delete("/feed_follows/{feedFollowID}", cfg.middlewareAuth(cfg.handlerDeleteFeedFollow))
 
+	// Admin
+	adminRouter := chi.NewRouter()
+	adminRouter.Get("/scraper", cfg.middlewareAdmin(cfg.handlerGetScraperStatus))
+	adminRouter.Put("/scraper", cfg.middlewareAdmin(cfg.handlerUpdateScraper))
+	adminRouter.Post("/scraper/pause", cfg.middlewareAdmin(cfg.handlerPauseScraper))
+	adminRouter.Post("/scraper/resume", cfg.middlewareAdmin(cfg.handlerResumeScraper))
+	adminRouter.Get("/retention/dry-run", cfg.middlewareAdmin(cfg.handlerRetentionDryRun))
+	adminRouter.Put("/feeds/{feedID}/retention", cfg.middlewareAdmin(cfg.handlerSetFeedRetention))
+	adminRouter.Delete("/feeds/{feedID}/retention", cfg.middlewareAdmin(cfg.handlerDeleteFeedRetention))
+	v1Router.Mount("/admin", adminRouter)
+
 	// V1
 	r.Mount("/v1", v1Router)
 
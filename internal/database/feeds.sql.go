@@ -7,30 +7,32 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
-const createFeed = `-- name: CreateFeed :one
-INSERT INTO feeds (id, name, url, user_id)
-VALUES ($1, $2, $3, $4)
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+const claimFeedForRefresh = `-- name: ClaimFeedForRefresh :one
+UPDATE feeds
+SET lease_owner = $1,
+lease_expires_at = NOW() + ($2::bigint * interval '1 second')
+WHERE id = $3
+AND disabled_at IS NULL
+AND status = 'active'
+AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_error_at, last_success_at, disabled_at, lease_owner, lease_expires_at, throttled_until, status, redirect_url, redirect_count, fetch_interval_seconds
 `
 
-type CreateFeedParams struct {
-	ID     uuid.UUID
-	Name   string
-	Url    string
-	UserID uuid.UUID
+type ClaimFeedForRefreshParams struct {
+	LeaseOwner   sql.NullString
+	LeaseSeconds int64
+	ID           uuid.UUID
 }
 
-func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, createFeed,
-		arg.ID,
-		arg.Name,
-		arg.Url,
-		arg.UserID,
-	)
+// Leases one feed for an on-demand scrape, due or not. No rows when someone
+// else holds its lease or it's not scraped anymore (dead or disabled).
+func (q *Queries) ClaimFeedForRefresh(ctx context.Context, arg ClaimFeedForRefreshParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, claimFeedForRefresh, arg.LeaseOwner, arg.LeaseSeconds, arg.ID)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -40,16 +42,53 @@ func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, e
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.ThrottledUntil,
+		&i.Status,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.FetchIntervalSeconds,
 	)
 	return i, err
 }
 
-const getFeeds = `-- name: GetFeeds :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
+const claimFeedsToFetch = `-- name: ClaimFeedsToFetch :many
+UPDATE feeds
+SET lease_owner = $1,
+lease_expires_at = NOW() + ($2::bigint * interval '1 second')
+WHERE id IN (
+    SELECT id FROM feeds
+    WHERE next_fetch_at <= NOW()
+    AND disabled_at IS NULL
+    AND status = 'active'
+    AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+    ORDER BY next_fetch_at ASC
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_error_at, last_success_at, disabled_at, lease_owner, lease_expires_at, throttled_until, status, redirect_url, redirect_count, fetch_interval_seconds
 `
 
-func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, getFeeds)
+type ClaimFeedsToFetchParams struct {
+	LeaseOwner   sql.NullString
+	LeaseSeconds int64
+	MaxFeeds     int32
+}
+
+// Leases the next due feeds to this instance. SKIP LOCKED makes concurrent
+// instances pick different rows instead of waiting on each other, and feeds
+// leased by someone else are skipped until the lease expires.
+func (q *Queries) ClaimFeedsToFetch(ctx context.Context, arg ClaimFeedsToFetchParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, claimFeedsToFetch, arg.LeaseOwner, arg.LeaseSeconds, arg.MaxFeeds)
 	if err != nil {
 		return nil, err
 	}
@@ -65,6 +104,21 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.ThrottledUntil,
+			&i.Status,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.FetchIntervalSeconds,
 		); err != nil {
 			return nil, err
 		}
@@ -79,14 +133,137 @@ func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
 	return items, nil
 }
 
-const getNextFeedsToFetch = `-- name: GetNextFeedsToFetch :many
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-ORDER BY last_fetched_at ASC NULLS FIRST
-LIMIT $1
+const createFeed = `-- name: CreateFeed :one
+INSERT INTO feeds (id, name, url, user_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_error_at, last_success_at, disabled_at, lease_owner, lease_expires_at, throttled_until, status, redirect_url, redirect_count, fetch_interval_seconds
+`
+
+type CreateFeedParams struct {
+	ID     uuid.UUID
+	Name   string
+	Url    string
+	UserID uuid.UUID
+}
+
+func (q *Queries) CreateFeed(ctx context.Context, arg CreateFeedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, createFeed,
+		arg.ID,
+		arg.Name,
+		arg.Url,
+		arg.UserID,
+	)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.ThrottledUntil,
+		&i.Status,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.FetchIntervalSeconds,
+	)
+	return i, err
+}
+
+const deleteFeed = `-- name: DeleteFeed :exec
+DELETE FROM feeds WHERE id = $1
+`
+
+func (q *Queries) DeleteFeed(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteFeed, id)
+	return err
+}
+
+const getFeedByID = `-- name: GetFeedByID :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_error_at, last_success_at, disabled_at, lease_owner, lease_expires_at, throttled_until, status, redirect_url, redirect_count, fetch_interval_seconds FROM feeds WHERE id = $1
+`
+
+func (q *Queries) GetFeedByID(ctx context.Context, id uuid.UUID) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByID, id)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.ThrottledUntil,
+		&i.Status,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.FetchIntervalSeconds,
+	)
+	return i, err
+}
+
+const getFeedByURL = `-- name: GetFeedByURL :one
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_error_at, last_success_at, disabled_at, lease_owner, lease_expires_at, throttled_until, status, redirect_url, redirect_count, fetch_interval_seconds FROM feeds WHERE url = $1
 `
 
-func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed, error) {
-	rows, err := q.db.QueryContext(ctx, getNextFeedsToFetch, limit)
+func (q *Queries) GetFeedByURL(ctx context.Context, url string) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getFeedByURL, url)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.ThrottledUntil,
+		&i.Status,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.FetchIntervalSeconds,
+	)
+	return i, err
+}
+
+const getFeeds = `-- name: GetFeeds :many
+SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_error_at, last_success_at, disabled_at, lease_owner, lease_expires_at, throttled_until, status, redirect_url, redirect_count, fetch_interval_seconds FROM feeds
+`
+
+func (q *Queries) GetFeeds(ctx context.Context) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFeeds)
 	if err != nil {
 		return nil, err
 	}
@@ -102,6 +279,21 @@ func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed,
 			&i.Url,
 			&i.UserID,
 			&i.LastFetchedAt,
+			&i.Etag,
+			&i.LastModified,
+			&i.NextFetchAt,
+			&i.ConsecutiveFailures,
+			&i.LastError,
+			&i.LastErrorAt,
+			&i.LastSuccessAt,
+			&i.DisabledAt,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.ThrottledUntil,
+			&i.Status,
+			&i.RedirectUrl,
+			&i.RedirectCount,
+			&i.FetchIntervalSeconds,
 		); err != nil {
 			return nil, err
 		}
@@ -116,16 +308,131 @@ func (q *Queries) GetNextFeedsToFetch(ctx context.Context, limit int32) ([]Feed,
 	return items, nil
 }
 
+const getOverdueFeedStats = `-- name: GetOverdueFeedStats :one
+SELECT COUNT(*) AS overdue,
+COALESCE(EXTRACT(EPOCH FROM NOW() - MIN(next_fetch_at)), 0)::bigint AS max_delay_seconds
+FROM feeds
+WHERE next_fetch_at <= NOW()
+AND disabled_at IS NULL
+AND status = 'active'
+AND (lease_expires_at IS NULL OR lease_expires_at < NOW())
+`
+
+type GetOverdueFeedStatsRow struct {
+	Overdue         int64
+	MaxDelaySeconds int64
+}
+
+// Feeds due but not claimed yet and how late the oldest one is, both grow
+// when scraping stalls.
+func (q *Queries) GetOverdueFeedStats(ctx context.Context) (GetOverdueFeedStatsRow, error) {
+	row := q.db.QueryRowContext(ctx, getOverdueFeedStats)
+	var i GetOverdueFeedStatsRow
+	err := row.Scan(&i.Overdue, &i.MaxDelaySeconds)
+	return i, err
+}
+
 const markFeedAsFetched = `-- name: MarkFeedAsFetched :one
 UPDATE feeds
 SET last_fetched_at = NOW(),
+next_fetch_at = NOW() + ($1::bigint * interval '1 second'),
 updated_at = NOW()
-WHERE id = $1
-RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at
+WHERE id = $2
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_error_at, last_success_at, disabled_at, lease_owner, lease_expires_at, throttled_until, status, redirect_url, redirect_count, fetch_interval_seconds
+`
+
+type MarkFeedAsFetchedParams struct {
+	NextFetchInSeconds int64
+	ID                 uuid.UUID
+}
+
+// next_fetch_at is provisional, so a feed that fails isn't retried every tick.
+// Computed from NOW() like last_fetched_at so both use the database clock.
+func (q *Queries) MarkFeedAsFetched(ctx context.Context, arg MarkFeedAsFetchedParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, markFeedAsFetched, arg.NextFetchInSeconds, arg.ID)
+	var i Feed
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Name,
+		&i.Url,
+		&i.UserID,
+		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.ThrottledUntil,
+		&i.Status,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.FetchIntervalSeconds,
+	)
+	return i, err
+}
+
+const markFeedDead = `-- name: MarkFeedDead :exec
+UPDATE feeds
+SET status = 'dead',
+last_error = $1,
+last_error_at = NOW(),
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = $2
+`
+
+type MarkFeedDeadParams struct {
+	LastError sql.NullString
+	ID        uuid.UUID
+}
+
+// The publisher answered 410 Gone, the feed won't be scraped again.
+func (q *Queries) MarkFeedDead(ctx context.Context, arg MarkFeedDeadParams) error {
+	_, err := q.db.ExecContext(ctx, markFeedDead, arg.LastError, arg.ID)
+	return err
+}
+
+const recordFeedFailure = `-- name: RecordFeedFailure :one
+UPDATE feeds
+SET consecutive_failures = consecutive_failures + 1,
+last_error = $1,
+last_error_at = NOW(),
+next_fetch_at = NOW() + ($2::bigint * interval '1 second'),
+disabled_at = CASE
+    WHEN consecutive_failures + 1 >= $3::integer THEN NOW()
+    ELSE disabled_at
+END,
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = $4
+RETURNING id, created_at, updated_at, name, url, user_id, last_fetched_at, etag, last_modified, next_fetch_at, consecutive_failures, last_error, last_error_at, last_success_at, disabled_at, lease_owner, lease_expires_at, throttled_until, status, redirect_url, redirect_count, fetch_interval_seconds
 `
 
-func (q *Queries) MarkFeedAsFetched(ctx context.Context, id uuid.UUID) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, markFeedAsFetched, id)
+type RecordFeedFailureParams struct {
+	LastError      sql.NullString
+	RetryInSeconds int64
+	MaxFailures    int32
+	ID             uuid.UUID
+}
+
+// Pushes the feed back by retry_in_seconds and disables it once it reaches
+// max_failures in a row.
+func (q *Queries) RecordFeedFailure(ctx context.Context, arg RecordFeedFailureParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, recordFeedFailure,
+		arg.LastError,
+		arg.RetryInSeconds,
+		arg.MaxFailures,
+		arg.ID,
+	)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -135,6 +442,158 @@ func (q *Queries) MarkFeedAsFetched(ctx context.Context, id uuid.UUID) (Feed, er
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.Etag,
+		&i.LastModified,
+		&i.NextFetchAt,
+		&i.ConsecutiveFailures,
+		&i.LastError,
+		&i.LastErrorAt,
+		&i.LastSuccessAt,
+		&i.DisabledAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.ThrottledUntil,
+		&i.Status,
+		&i.RedirectUrl,
+		&i.RedirectCount,
+		&i.FetchIntervalSeconds,
 	)
 	return i, err
 }
+
+const recordFeedRedirect = `-- name: RecordFeedRedirect :one
+UPDATE feeds
+SET redirect_count = CASE
+    WHEN redirect_url = $1::text THEN redirect_count + 1
+    ELSE 1
+END,
+redirect_url = $1::text,
+updated_at = NOW()
+WHERE id = $2
+RETURNING redirect_count
+`
+
+type RecordFeedRedirectParams struct {
+	RedirectUrl string
+	ID          uuid.UUID
+}
+
+// Counts fetches permanently redirected to the same URL in a row, a different
+// target starts over at 1.
+func (q *Queries) RecordFeedRedirect(ctx context.Context, arg RecordFeedRedirectParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, recordFeedRedirect, arg.RedirectUrl, arg.ID)
+	var redirect_count int32
+	err := row.Scan(&redirect_count)
+	return redirect_count, err
+}
+
+const recordFeedSuccess = `-- name: RecordFeedSuccess :exec
+UPDATE feeds
+SET consecutive_failures = 0,
+last_success_at = NOW(),
+lease_owner = NULL,
+lease_expires_at = NULL,
+next_fetch_at = NOW() + ($1::bigint * interval '1 second'),
+fetch_interval_seconds = $2::integer,
+updated_at = NOW()
+WHERE id = $3
+`
+
+type RecordFeedSuccessParams struct {
+	NextFetchInSeconds   int64
+	FetchIntervalSeconds int32
+	ID                   uuid.UUID
+}
+
+// fetch_interval_seconds is the feed's own pace, next_fetch_in_seconds when we
+// fetch it next (the pace with the Cache-Control hints, or WebSub's).
+func (q *Queries) RecordFeedSuccess(ctx context.Context, arg RecordFeedSuccessParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedSuccess, arg.NextFetchInSeconds, arg.FetchIntervalSeconds, arg.ID)
+	return err
+}
+
+const recordFeedThrottled = `-- name: RecordFeedThrottled :exec
+UPDATE feeds
+SET throttled_until = NOW() + ($1::bigint * interval '1 second'),
+next_fetch_at = NOW() + ($1::bigint * interval '1 second'),
+lease_owner = NULL,
+lease_expires_at = NULL,
+updated_at = NOW()
+WHERE id = $2
+`
+
+type RecordFeedThrottledParams struct {
+	RetryInSeconds int64
+	ID             uuid.UUID
+}
+
+// The publisher asked us to slow down, the feed waits retry_in_seconds but
+// it's not a failure so it keeps its failure count.
+func (q *Queries) RecordFeedThrottled(ctx context.Context, arg RecordFeedThrottledParams) error {
+	_, err := q.db.ExecContext(ctx, recordFeedThrottled, arg.RetryInSeconds, arg.ID)
+	return err
+}
+
+const releaseFeedLeases = `-- name: ReleaseFeedLeases :exec
+UPDATE feeds
+SET lease_owner = NULL,
+lease_expires_at = NULL
+WHERE lease_owner = $1
+`
+
+// Gives back whatever the instance still holds, on shutdown.
+func (q *Queries) ReleaseFeedLeases(ctx context.Context, leaseOwner sql.NullString) error {
+	_, err := q.db.ExecContext(ctx, releaseFeedLeases, leaseOwner)
+	return err
+}
+
+const resetFeedRedirect = `-- name: ResetFeedRedirect :exec
+UPDATE feeds
+SET redirect_url = NULL,
+redirect_count = 0,
+updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) ResetFeedRedirect(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, resetFeedRedirect, id)
+	return err
+}
+
+const updateFeedCacheValidators = `-- name: UpdateFeedCacheValidators :exec
+UPDATE feeds
+SET etag = $2,
+last_modified = $3
+WHERE id = $1
+`
+
+type UpdateFeedCacheValidatorsParams struct {
+	ID           uuid.UUID
+	Etag         sql.NullString
+	LastModified sql.NullString
+}
+
+func (q *Queries) UpdateFeedCacheValidators(ctx context.Context, arg UpdateFeedCacheValidatorsParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedCacheValidators, arg.ID, arg.Etag, arg.LastModified)
+	return err
+}
+
+const updateFeedURL = `-- name: UpdateFeedURL :exec
+UPDATE feeds
+SET url = $2,
+redirect_url = NULL,
+redirect_count = 0,
+updated_at = NOW()
+WHERE id = $1
+`
+
+type UpdateFeedURLParams struct {
+	ID  uuid.UUID
+	Url string
+}
+
+// Moves the feed to where it's permanently redirected.
+func (q *Queries) UpdateFeedURL(ctx context.Context, arg UpdateFeedURLParams) error {
+	_, err := q.db.ExecContext(ctx, updateFeedURL, arg.ID, arg.Url)
+	return err
+}
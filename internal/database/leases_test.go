@@ -0,0 +1,198 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to DB_URL, a disposable database with the migrations
+// applied (goose up). Tests needing it are skipped when it's not set.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		t.Skip("DB_URL not set, skipping Postgres test")
+	}
+
+	conn, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.Ping(); err != nil {
+		t.Fatalf("can't reach DB_URL: %v", err)
+	}
+	return conn
+}
+
+// createTestFeeds creates a user owning count due feeds, all deleted with
+// the user at the end of the test.
+func createTestFeeds(t *testing.T, conn *sql.DB, count int) []uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	db := database.New(conn)
+
+	user, err := db.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), FirstName: "Lease", LastName: "Test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := conn.Exec("DELETE FROM users WHERE id = $1", user.ID); err != nil {
+			t.Errorf("cleanup: %v", err)
+		}
+	})
+
+	ids := make([]uuid.UUID, count)
+	for i := range ids {
+		feed, err := db.CreateFeed(ctx, database.CreateFeedParams{
+			ID:     uuid.New(),
+			Name:   fmt.Sprintf("lease test %d", i),
+			Url:    fmt.Sprintf("https://example.com/%s.xml", uuid.NewString()),
+			UserID: user.ID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = feed.ID
+	}
+	return ids
+}
+
+// N instances claiming due feeds and refreshing random ones at the same time
+// must never work on the same feed at once.
+func TestFeedLeasesAreExclusive(t *testing.T) {
+	conn := openTestDB(t)
+	feedIDs := createTestFeeds(t, conn, 30)
+	ours := map[uuid.UUID]bool{}
+	for _, id := range feedIDs {
+		ours[id] = true
+	}
+
+	const instances = 8
+	const rounds = 40
+
+	var mu sync.Mutex
+	inFlight := map[uuid.UUID]string{} // feed → instance working on it
+	processed := map[uuid.UUID]int{}
+
+	// process stands for a scrape: the feed must be ours alone until we give
+	// the lease back, like RecordFeedSuccess does at the end of a scrape.
+	process := func(ctx context.Context, db *database.Queries, owner string, feedID uuid.UUID) {
+		mu.Lock()
+		if other, ok := inFlight[feedID]; ok {
+			t.Errorf("feed %s claimed by %s while %s works on it", feedID, owner, other)
+		}
+		inFlight[feedID] = owner
+		mu.Unlock()
+
+		time.Sleep(time.Duration(rand.IntN(3)) * time.Millisecond)
+
+		mu.Lock()
+		delete(inFlight, feedID) // before the release, someone may claim it right after
+		processed[feedID]++
+		mu.Unlock()
+
+		err := db.RecordFeedSuccess(ctx, database.RecordFeedSuccessParams{NextFetchInSeconds: 0, ID: feedID})
+		if err != nil {
+			t.Errorf("release %s: %v", feedID, err)
+		}
+	}
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			db := database.New(conn)
+			owner := fmt.Sprintf("instance-%d", i)
+			leaseOwner := sql.NullString{String: owner, Valid: true}
+
+			for range rounds {
+				claimed, err := db.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+					LeaseOwner:   leaseOwner,
+					LeaseSeconds: 60,
+					MaxFeeds:     5,
+				})
+				if err != nil {
+					t.Errorf("%s: claim: %v", owner, err)
+					return
+				}
+				for _, feed := range claimed {
+					if ours[feed.ID] {
+						process(ctx, db, owner, feed.ID)
+					}
+				}
+
+				// an on-demand refresh of a random feed, busy or not
+				feedID := feedIDs[rand.IntN(len(feedIDs))]
+				_, err = db.ClaimFeedForRefresh(ctx, database.ClaimFeedForRefreshParams{
+					LeaseOwner:   leaseOwner,
+					LeaseSeconds: 60,
+					ID:           feedID,
+				})
+				if errors.Is(err, sql.ErrNoRows) {
+					continue // someone else holds it
+				}
+				if err != nil {
+					t.Errorf("%s: claim for refresh: %v", owner, err)
+					return
+				}
+				process(ctx, db, owner, feedID)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// feeds that aren't ours were claimed too, hand them back
+	for i := range instances {
+		owner := sql.NullString{String: fmt.Sprintf("instance-%d", i), Valid: true}
+		if err := database.New(conn).ReleaseFeedLeases(ctx, owner); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, id := range feedIDs {
+		if processed[id] == 0 {
+			t.Errorf("feed %s was never processed", id)
+		}
+	}
+}
+
+func TestFeedLeaseRelease(t *testing.T) {
+	conn := openTestDB(t)
+	feedID := createTestFeeds(t, conn, 1)[0]
+	db := database.New(conn)
+	ctx := context.Background()
+	a := sql.NullString{String: "instance-a", Valid: true}
+	b := sql.NullString{String: "instance-b", Valid: true}
+
+	claim := func(owner sql.NullString) error {
+		_, err := db.ClaimFeedForRefresh(ctx, database.ClaimFeedForRefreshParams{LeaseOwner: owner, LeaseSeconds: 3600, ID: feedID})
+		return err
+	}
+
+	if err := claim(a); err != nil {
+		t.Fatalf("a claims: %v", err)
+	}
+	if err := claim(b); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("b claims a's feed: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := db.ReleaseFeedLeases(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := claim(b); err != nil {
+		t.Fatalf("b claims once a released: %v", err)
+	}
+}
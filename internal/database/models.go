@@ -12,13 +12,43 @@ import (
 )
 
 type Feed struct {
+	ID                   uuid.UUID
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+	Name                 string
+	Url                  string
+	UserID               uuid.UUID
+	LastFetchedAt        sql.NullTime
+	Etag                 sql.NullString
+	LastModified         sql.NullString
+	NextFetchAt          time.Time
+	ConsecutiveFailures  int32
+	LastError            sql.NullString
+	LastErrorAt          sql.NullTime
+	LastSuccessAt        sql.NullTime
+	DisabledAt           sql.NullTime
+	LeaseOwner           sql.NullString
+	LeaseExpiresAt       sql.NullTime
+	ThrottledUntil       sql.NullTime
+	Status               string
+	RedirectUrl          sql.NullString
+	RedirectCount        int32
+	FetchIntervalSeconds sql.NullInt32
+}
+
+type FeedFetch struct {
 	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	FeedID        uuid.UUID
+	StartedAt     time.Time
+	FinishedAt    time.Time
+	DurationMs    int64
+	HttpStatus    sql.NullInt32
+	Bytes         int64
+	ItemsSeen     int32
+	PostsInserted int32
+	PostsUpdated  int32
+	PostsSkipped  int32
+	Error         sql.NullString
 }
 
 type FeedFollow struct {
@@ -29,6 +59,24 @@ type FeedFollow struct {
 	FeedID    uuid.UUID
 }
 
+type FeedRetentionPolicy struct {
+	FeedID    uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	KeepDays  sql.NullInt32
+	KeepPosts sql.NullInt32
+}
+
+type JobRun struct {
+	ID           uuid.UUID
+	JobName      string
+	ScheduledFor time.Time
+	InstanceID   string
+	StartedAt    time.Time
+	FinishedAt   sql.NullTime
+	Error        sql.NullString
+}
+
 type Post struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
@@ -38,6 +86,44 @@ type Post struct {
 	PublishedAt time.Time
 	Url         string
 	FeedID      uuid.UUID
+	Content     sql.NullString
+	Author      sql.NullString
+	CommentsUrl sql.NullString
+	ImageUrl    sql.NullString
+	Guid        string
+	ContentHash string
+}
+
+type PostCategory struct {
+	PostID uuid.UUID
+	Name   string
+}
+
+type PostEnclosure struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	PostID    uuid.UUID
+	Url       string
+	MimeType  sql.NullString
+	Length    sql.NullInt64
+}
+
+type PostRevision struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	PostID      uuid.UUID
+	Title       string
+	Description sql.NullString
+	ContentHash string
+}
+
+type ScraperSetting struct {
+	ID              bool
+	UpdatedAt       time.Time
+	Paused          bool
+	Concurrency     sql.NullInt32
+	IntervalSeconds sql.NullInt32
 }
 
 type User struct {
@@ -47,4 +133,17 @@ type User struct {
 	FirstName string
 	LastName  string
 	ApiKey    string
+	IsAdmin   bool
+}
+
+type WebsubSubscription struct {
+	FeedID         uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	HubUrl         string
+	TopicUrl       string
+	Secret         string
+	State          string
+	LeaseSeconds   sql.NullInt32
+	LeaseExpiresAt sql.NullTime
 }
@@ -7,36 +7,211 @@ package database
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
-const createPost = `-- name: CreatePost :one
-INSERT INTO posts (id, title, description, published_at, url, feed_id)
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, created_at, updated_at, title, description, published_at, url, feed_id
+const adoptLegacyPosts = `-- name: AdoptLegacyPosts :execrows
+UPDATE posts
+SET guid = item.guid
+FROM (
+    SELECT DISTINCT ON (item.url) item.guid, item.url
+    FROM unnest($1::text[], $2::text[]) AS item(guid, url)
+    WHERE item.url <> '' AND item.guid <> item.url
+    ORDER BY item.url, item.guid
+) item
+WHERE posts.feed_id = $3 AND posts.url = item.url AND posts.guid = posts.url
+AND NOT EXISTS (
+    SELECT 1 FROM posts existing
+    WHERE existing.feed_id = $3 AND existing.guid = item.guid
+)
+`
+
+type AdoptLegacyPostsParams struct {
+	Guids  []string
+	Urls   []string
+	FeedID uuid.UUID
+}
+
+// Posts stored before guids existed were keyed by their url (migration 011).
+// When the feed now gives one of them a different guid, the post is re-keyed
+// to it so UpsertPosts updates it instead of inserting a duplicate. Only posts
+// still keyed by their url, and only when the feed has no post with that guid
+// yet. Element i of each array is item i, one post per url at most.
+func (q *Queries) AdoptLegacyPosts(ctx context.Context, arg AdoptLegacyPostsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, adoptLegacyPosts, pq.Array(arg.Guids), pq.Array(arg.Urls), arg.FeedID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const createPostCategories = `-- name: CreatePostCategories :exec
+INSERT INTO post_categories (post_id, name)
+SELECT category.post_id, category.name
+FROM unnest($1::uuid[], $2::text[]) AS category(post_id, name)
+ON CONFLICT DO NOTHING
 `
 
-type CreatePostParams struct {
-	ID          uuid.UUID
-	Title       string
-	Description sql.NullString
-	PublishedAt time.Time
-	Url         string
-	FeedID      uuid.UUID
-}
-
-func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, error) {
-	row := q.db.QueryRowContext(ctx, createPost,
-		arg.ID,
-		arg.Title,
-		arg.Description,
-		arg.PublishedAt,
-		arg.Url,
+type CreatePostCategoriesParams struct {
+	PostIds []uuid.UUID
+	Names   []string
+}
+
+// Element i of each array is category i.
+func (q *Queries) CreatePostCategories(ctx context.Context, arg CreatePostCategoriesParams) error {
+	_, err := q.db.ExecContext(ctx, createPostCategories, pq.Array(arg.PostIds), pq.Array(arg.Names))
+	return err
+}
+
+const createPostEnclosures = `-- name: CreatePostEnclosures :exec
+INSERT INTO post_enclosures (id, post_id, url, mime_type, length)
+SELECT enclosure.id, enclosure.post_id, enclosure.url, NULLIF(enclosure.mime_type, ''), NULLIF(enclosure.length, 0)
+FROM unnest(
+    $1::uuid[],
+    $2::uuid[],
+    $3::text[],
+    $4::text[],
+    $5::bigint[]
+) AS enclosure(id, post_id, url, mime_type, length)
+ON CONFLICT (post_id, url) DO NOTHING
+`
+
+type CreatePostEnclosuresParams struct {
+	Ids       []uuid.UUID
+	PostIds   []uuid.UUID
+	Urls      []string
+	MimeTypes []string
+	Lengths   []int64
+}
+
+// Element i of each array is enclosure i. A 0 length or empty mime type is
+// stored as NULL.
+func (q *Queries) CreatePostEnclosures(ctx context.Context, arg CreatePostEnclosuresParams) error {
+	_, err := q.db.ExecContext(ctx, createPostEnclosures,
+		pq.Array(arg.Ids),
+		pq.Array(arg.PostIds),
+		pq.Array(arg.Urls),
+		pq.Array(arg.MimeTypes),
+		pq.Array(arg.Lengths),
+	)
+	return err
+}
+
+const createPostRevisions = `-- name: CreatePostRevisions :exec
+INSERT INTO post_revisions (id, post_id, title, description, content_hash)
+SELECT item.id, posts.id, posts.title, posts.description, posts.content_hash
+FROM posts
+JOIN unnest(
+    $1::uuid[],
+    $2::text[],
+    $3::text[],
+    $4::text[],
+    $5::text[]
+) AS item(id, guid, title, description, content_hash) ON posts.guid = item.guid
+WHERE posts.feed_id = $6 AND posts.content_hash <> item.content_hash
+AND (posts.title <> item.title OR posts.description IS DISTINCT FROM NULLIF(item.description, ''))
+`
+
+type CreatePostRevisionsParams struct {
+	Ids           []uuid.UUID
+	Guids         []string
+	Titles        []string
+	Descriptions  []string
+	ContentHashes []string
+	FeedID        uuid.UUID
+}
+
+// Snapshots the current version of the posts UpsertPosts is about to
+// overwrite. Posts that don't exist yet or whose hash didn't change are left
+// alone, and so are the ones whose title and description stay the same:
+// that's all a revision keeps (e.g. old posts only getting their content).
+func (q *Queries) CreatePostRevisions(ctx context.Context, arg CreatePostRevisionsParams) error {
+	_, err := q.db.ExecContext(ctx, createPostRevisions,
+		pq.Array(arg.Ids),
+		pq.Array(arg.Guids),
+		pq.Array(arg.Titles),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.ContentHashes),
 		arg.FeedID,
 	)
+	return err
+}
+
+const getCategoriesForPosts = `-- name: GetCategoriesForPosts :many
+SELECT post_id, name FROM post_categories
+WHERE post_id = ANY($1::uuid[])
+ORDER BY name
+`
+
+func (q *Queries) GetCategoriesForPosts(ctx context.Context, postIds []uuid.UUID) ([]PostCategory, error) {
+	rows, err := q.db.QueryContext(ctx, getCategoriesForPosts, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostCategory
+	for rows.Next() {
+		var i PostCategory
+		if err := rows.Scan(&i.PostID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getEnclosuresForPosts = `-- name: GetEnclosuresForPosts :many
+SELECT id, created_at, updated_at, post_id, url, mime_type, length FROM post_enclosures
+WHERE post_id = ANY($1::uuid[])
+ORDER BY created_at
+`
+
+func (q *Queries) GetEnclosuresForPosts(ctx context.Context, postIds []uuid.UUID) ([]PostEnclosure, error) {
+	rows, err := q.db.QueryContext(ctx, getEnclosuresForPosts, pq.Array(postIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostEnclosure
+	for rows.Next() {
+		var i PostEnclosure
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.PostID,
+			&i.Url,
+			&i.MimeType,
+			&i.Length,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPostByID = `-- name: GetPostByID :one
+SELECT id, created_at, updated_at, title, description, published_at, url, feed_id, content, author, comments_url, image_url, guid, content_hash FROM posts WHERE id = $1
+`
+
+func (q *Queries) GetPostByID(ctx context.Context, id uuid.UUID) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByID, id)
 	var i Post
 	err := row.Scan(
 		&i.ID,
@@ -47,12 +222,54 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) (Post, e
 		&i.PublishedAt,
 		&i.Url,
 		&i.FeedID,
+		&i.Content,
+		&i.Author,
+		&i.CommentsUrl,
+		&i.ImageUrl,
+		&i.Guid,
+		&i.ContentHash,
 	)
 	return i, err
 }
 
+const getPostRevisions = `-- name: GetPostRevisions :many
+SELECT id, created_at, post_id, title, description, content_hash FROM post_revisions
+WHERE post_id = $1
+ORDER BY created_at DESC
+`
+
+func (q *Queries) GetPostRevisions(ctx context.Context, postID uuid.UUID) ([]PostRevision, error) {
+	rows, err := q.db.QueryContext(ctx, getPostRevisions, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PostRevision
+	for rows.Next() {
+		var i PostRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.PostID,
+			&i.Title,
+			&i.Description,
+			&i.ContentHash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id from posts
+SELECT posts.id, posts.created_at, posts.updated_at, posts.title, posts.description, posts.published_at, posts.url, posts.feed_id, posts.content, posts.author, posts.comments_url, posts.image_url, posts.guid, posts.content_hash from posts
 JOIN feed_follows ON posts.feed_id = feed_follows.feed_id
 WHERE feed_follows.user_id = $1 LIMIT $2
 `
@@ -80,6 +297,12 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 			&i.PublishedAt,
 			&i.Url,
 			&i.FeedID,
+			&i.Content,
+			&i.Author,
+			&i.CommentsUrl,
+			&i.ImageUrl,
+			&i.Guid,
+			&i.ContentHash,
 		); err != nil {
 			return nil, err
 		}
@@ -93,3 +316,126 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const movePostsToFeed = `-- name: MovePostsToFeed :exec
+UPDATE posts
+SET feed_id = $1, updated_at = NOW()
+WHERE feed_id = $2
+AND guid NOT IN (SELECT guid FROM posts WHERE feed_id = $1)
+`
+
+type MovePostsToFeedParams struct {
+	ToFeedID   uuid.UUID
+	FromFeedID uuid.UUID
+}
+
+// Used when merging feeds. Posts the target already has (same guid) stay
+// behind and go away with the source feed.
+func (q *Queries) MovePostsToFeed(ctx context.Context, arg MovePostsToFeedParams) error {
+	_, err := q.db.ExecContext(ctx, movePostsToFeed, arg.ToFeedID, arg.FromFeedID)
+	return err
+}
+
+const upsertPosts = `-- name: UpsertPosts :many
+INSERT INTO posts (id, title, description, published_at, url, feed_id, content, author, comments_url, image_url, guid, content_hash)
+SELECT item.id, item.title, NULLIF(item.description, ''),
+CASE WHEN item.has_date THEN item.published_at ELSE COALESCE(
+    (SELECT posts.published_at FROM posts WHERE posts.feed_id = $1 AND posts.guid = item.guid),
+    item.published_at
+) END,
+item.url, $1,
+NULLIF(item.content, ''), NULLIF(item.author, ''), NULLIF(item.comments_url, ''), NULLIF(item.image_url, ''), item.guid, item.content_hash
+FROM unnest(
+    $2::uuid[],
+    $3::text[],
+    $4::text[],
+    $5::timestamp[],
+    $6::text[],
+    $7::text[],
+    $8::text[],
+    $9::text[],
+    $10::text[],
+    $11::text[],
+    $12::text[],
+    $13::boolean[]
+) AS item(id, title, description, published_at, url, content, author, comments_url, image_url, guid, content_hash, has_date)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+description = EXCLUDED.description,
+published_at = EXCLUDED.published_at,
+url = EXCLUDED.url,
+content = EXCLUDED.content,
+author = EXCLUDED.author,
+comments_url = EXCLUDED.comments_url,
+image_url = EXCLUDED.image_url,
+content_hash = EXCLUDED.content_hash,
+updated_at = NOW()
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING id, guid, (xmax = 0)::boolean AS inserted
+`
+
+type UpsertPostsParams struct {
+	FeedID        uuid.UUID
+	Ids           []uuid.UUID
+	Titles        []string
+	Descriptions  []string
+	PublishedAts  []time.Time
+	Urls          []string
+	Contents      []string
+	Authors       []string
+	CommentsUrls  []string
+	ImageUrls     []string
+	Guids         []string
+	ContentHashes []string
+	HasDates      []bool
+}
+
+type UpsertPostsRow struct {
+	ID       uuid.UUID
+	Guid     string
+	Inserted bool
+}
+
+// Inserts the posts of a feed or updates the ones whose content hash changed,
+// in one statement: element i of each array is post i, no guid twice (ON
+// CONFLICT can't update a row twice). Unchanged posts are not returned.
+// inserted is true for new posts (xmax is only set on rows that were updated).
+// Empty optional fields are stored as NULL. Items without a usable date
+// (has_dates false) keep the published_at they were first stored with, an
+// edit must not bring them back to the top.
+func (q *Queries) UpsertPosts(ctx context.Context, arg UpsertPostsParams) ([]UpsertPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, upsertPosts,
+		arg.FeedID,
+		pq.Array(arg.Ids),
+		pq.Array(arg.Titles),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.PublishedAts),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Contents),
+		pq.Array(arg.Authors),
+		pq.Array(arg.CommentsUrls),
+		pq.Array(arg.ImageUrls),
+		pq.Array(arg.Guids),
+		pq.Array(arg.ContentHashes),
+		pq.Array(arg.HasDates),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpsertPostsRow
+	for rows.Next() {
+		var i UpsertPostsRow
+		if err := rows.Scan(&i.ID, &i.Guid, &i.Inserted); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
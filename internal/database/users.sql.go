@@ -14,7 +14,7 @@ import (
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, first_name, last_name, api_key)
 VALUES ($1, $2, $3, encode(sha256(random()::text::bytea), 'hex'))
-RETURNING id, created_at, updated_at, first_name, last_name, api_key
+RETURNING id, created_at, updated_at, first_name, last_name, api_key, is_admin
 `
 
 type CreateUserParams struct {
@@ -33,12 +33,13 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.FirstName,
 		&i.LastName,
 		&i.ApiKey,
+		&i.IsAdmin,
 	)
 	return i, err
 }
 
 const getUserByAPIKey = `-- name: GetUserByAPIKey :one
-SELECT id, created_at, updated_at, first_name, last_name, api_key FROM users WHERE api_key = $1
+SELECT id, created_at, updated_at, first_name, last_name, api_key, is_admin FROM users WHERE api_key = $1
 `
 
 func (q *Queries) GetUserByAPIKey(ctx context.Context, apiKey string) (User, error) {
@@ -51,6 +52,7 @@ func (q *Queries) GetUserByAPIKey(ctx context.Context, apiKey string) (User, err
 		&i.FirstName,
 		&i.LastName,
 		&i.ApiKey,
+		&i.IsAdmin,
 	)
 	return i, err
 }
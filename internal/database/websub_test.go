@@ -0,0 +1,61 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+)
+
+// Verifications are only accepted while we wait for one: replaying the
+// hub's call must not extend the lease.
+func TestConfirmWebsubSubscription(t *testing.T) {
+	conn := openTestDB(t)
+	feedID := createTestFeeds(t, conn, 1)[0]
+	db := database.New(conn)
+	ctx := context.Background()
+
+	subscribe := func() {
+		t.Helper()
+		err := db.UpsertWebsubSubscription(ctx, database.UpsertWebsubSubscriptionParams{
+			FeedID:   feedID,
+			HubUrl:   "https://hub.example.com/",
+			TopicUrl: "https://example.com/feed.xml",
+			Secret:   "secret",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	confirm := func(topic string) int64 {
+		t.Helper()
+		rows, err := db.ConfirmWebsubSubscription(ctx, database.ConfirmWebsubSubscriptionParams{
+			LeaseSeconds: 3600,
+			FeedID:       feedID,
+			TopicUrl:     topic,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+
+	subscribe()
+	if rows := confirm("https://example.com/other.xml"); rows != 0 {
+		t.Errorf("confirm other topic: %d rows, want 0", rows)
+	}
+	if rows := confirm("https://example.com/feed.xml"); rows != 1 {
+		t.Fatalf("confirm pending: %d rows, want 1", rows)
+	}
+	if rows := confirm("https://example.com/feed.xml"); rows != 0 {
+		t.Errorf("confirm again: %d rows, want 0", rows)
+	}
+
+	subscribe() // renewal, stays subscribed
+	if rows := confirm("https://example.com/feed.xml"); rows != 1 {
+		t.Errorf("confirm renewal: %d rows, want 1", rows)
+	}
+	if rows := confirm("https://example.com/feed.xml"); rows != 0 {
+		t.Errorf("confirm renewal again: %d rows, want 0", rows)
+	}
+}
@@ -0,0 +1,148 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type AtomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    AtomText    `xml:"http://www.w3.org/2005/Atom title"`
+	Subtitle AtomText    `xml:"http://www.w3.org/2005/Atom subtitle"`
+	Links    []AtomLink  `xml:"http://www.w3.org/2005/Atom link"`
+	Entries  []AtomEntry `xml:"http://www.w3.org/2005/Atom entry"`
+}
+
+// Fields are namespaced so extensions with the same local name (media:content,
+// itunes:author...) don't get mixed with the Atom ones.
+type AtomEntry struct {
+	ID         string         `xml:"http://www.w3.org/2005/Atom id"`
+	Title      AtomText       `xml:"http://www.w3.org/2005/Atom title"`
+	Links      []AtomLink     `xml:"http://www.w3.org/2005/Atom link"`
+	Summary    AtomText       `xml:"http://www.w3.org/2005/Atom summary"`
+	Content    AtomText       `xml:"http://www.w3.org/2005/Atom content"`
+	Published  string         `xml:"http://www.w3.org/2005/Atom published"`
+	Updated    string         `xml:"http://www.w3.org/2005/Atom updated"`
+	Authors    []AtomPerson   `xml:"http://www.w3.org/2005/Atom author"`
+	Categories []AtomCategory `xml:"http://www.w3.org/2005/Atom category"`
+	Media
+}
+
+type AtomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"http://www.w3.org/2005/Atom name"`
+}
+
+type AtomCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr"`
+}
+
+// Atom text constructs can be plain text, escaped html or inline xhtml.
+// For xhtml the markup lives as child elements, so we need the inner XML
+// instead of the char data.
+type AtomText struct {
+	Type     string `xml:"type,attr"`
+	Text     string `xml:",chardata"`
+	InnerXML string `xml:",innerxml"`
+}
+
+func (t AtomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.InnerXML)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// alternateLink returns the href of the rel="alternate" link (rel defaults to
+// alternate when missing) which is the URL of the page the entry points to.
+func alternateLink(links []AtomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+func linkWithRel(links []AtomLink, rel string) string {
+	for _, link := range links {
+		if link.Rel == rel {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	return ""
+}
+
+// Atom attaches files as <link rel="enclosure">, same idea as the RSS <enclosure>.
+func atomEnclosures(links []AtomLink) []Enclosure {
+	enclosures := []Enclosure{}
+	for _, link := range links {
+		if link.Rel == "enclosure" {
+			enclosures = append(enclosures, Enclosure{
+				URL:    strings.TrimSpace(link.Href),
+				Type:   link.Type,
+				Length: parseLength(link.Length),
+			})
+		}
+	}
+	return enclosures
+}
+
+func (a AtomFeed) toFeed() Feed {
+	feed := Feed{
+		Title:       a.Title.String(),
+		Link:        alternateLink(a.Links),
+		Description: a.Subtitle.String(),
+		Items:       make([]Item, len(a.Entries)),
+		Hub:         linkWithRel(a.Links, "hub"),
+		Self:        linkWithRel(a.Links, "self"),
+	}
+
+	for i, entry := range a.Entries {
+		// summary is the teaser, content the full body, we prefer the teaser like RSS description
+		description := entry.Summary.String()
+		if description == "" {
+			description = entry.Content.String()
+		}
+
+		// published is optional in Atom, updated is mandatory
+		pubDate := entry.Published
+		if pubDate == "" {
+			pubDate = entry.Updated
+		}
+
+		authors := make([]string, len(entry.Authors))
+		for j, author := range entry.Authors {
+			authors[j] = author.Name
+		}
+
+		categories := make([]string, len(entry.Categories))
+		for j, category := range entry.Categories {
+			categories[j] = category.Term
+		}
+
+		feed.Items[i] = Item{
+			ID:          strings.TrimSpace(entry.ID),
+			Title:       entry.Title.String(),
+			Link:        alternateLink(entry.Links),
+			Description: description,
+			Content:     entry.Content.String(),
+			Authors:     trimAll(authors),
+			Categories:  trimAll(categories),
+			ImageURL:    entry.Media.thumbnail(),
+			Enclosures:  mergeEnclosures(atomEnclosures(entry.Links), entry.Media.enclosures()),
+			PubDate:     strings.TrimSpace(pubDate),
+		}
+	}
+
+	return feed
+}
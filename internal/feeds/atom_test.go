@@ -0,0 +1,121 @@
+package feeds
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseAtom(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want Feed
+	}{
+		{
+			name: "full entry",
+			doc: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+  <title>Example Blog</title>
+  <subtitle>All the news</subtitle>
+  <link href="https://example.com/"/>
+  <link rel="self" href="https://example.com/atom.xml"/>
+  <link rel="hub" href=" https://hub.example.com/ "/>
+  <entry>
+    <id> urn:uuid:1 </id>
+    <title>First post</title>
+    <link rel="alternate" href="https://example.com/1"/>
+    <link rel="enclosure" href="https://example.com/1.mp3" type="audio/mpeg" length="1234"/>
+    <summary>Teaser</summary>
+    <content type="html">&lt;p&gt;Full body&lt;/p&gt;</content>
+    <published>2024-01-02T10:00:00Z</published>
+    <updated>2024-01-03T10:00:00Z</updated>
+    <author><name>Ana</name></author>
+    <author><name> Bob </name></author>
+    <category term="go"/>
+    <category term=" "/>
+    <media:thumbnail url="https://example.com/1.jpg"/>
+    <media:content url="https://example.com/1.mp3" type="audio/mpeg"/>
+  </entry>
+</feed>`,
+			want: Feed{
+				Title:       "Example Blog",
+				Link:        "https://example.com/",
+				Description: "All the news",
+				Hub:         "https://hub.example.com/",
+				Self:        "https://example.com/atom.xml",
+				Items: []Item{{
+					ID:          "urn:uuid:1",
+					Title:       "First post",
+					Link:        "https://example.com/1",
+					Description: "Teaser",
+					Content:     "<p>Full body</p>",
+					Authors:     []string{"Ana", "Bob"},
+					Categories:  []string{"go"},
+					ImageURL:    "https://example.com/1.jpg",
+					Enclosures:  []Enclosure{{URL: "https://example.com/1.mp3", Type: "audio/mpeg", Length: 1234}},
+					PubDate:     "2024-01-02T10:00:00Z",
+				}},
+			},
+		},
+		{
+			name: "content only, updated only, xhtml title",
+			doc: `<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><b>Bold</b></div></title>
+  <entry>
+    <title>No summary</title>
+    <link href="https://example.com/2"/>
+    <content>Body only</content>
+    <updated>2024-01-03T10:00:00Z</updated>
+  </entry>
+</feed>`,
+			want: Feed{
+				Title: `<div xmlns="http://www.w3.org/1999/xhtml"><b>Bold</b></div>`,
+				Items: []Item{{
+					Title:       "No summary",
+					Link:        "https://example.com/2",
+					Description: "Body only",
+					Content:     "Body only",
+					Authors:     []string{},
+					Categories:  []string{},
+					Enclosures:  []Enclosure{},
+					PubDate:     "2024-01-03T10:00:00Z",
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.doc), "application/atom+xml")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		contentType string
+	}{
+		{"html page", `<html><body>hi</body></html>`, "text/html"},
+		{"feed without atom namespace", `<feed><entry/></feed>`, "application/xml"},
+		{"empty", ``, "application/xml"},
+		{"json without version", `{"items": []}`, "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.doc), tt.contentType)
+			if !errors.Is(err, ErrUnsupportedFormat) {
+				t.Errorf("Parse error = %v, want %v", err, ErrUnsupportedFormat)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+
+	"golang.org/x/net/html/charset"
+)
+
+// newXMLDecoder returns a decoder that understands non UTF-8 documents
+// (ISO-8859-x, windows-125x, KOI8-R, Shift_JIS, EUC-KR, ...).
+//
+// Where the charset comes from, in order:
+//  1. charset param of the HTTP Content-Type, it wins over the document (RFC 7303)
+//  2. encoding of the XML declaration, <?xml version="1.0" encoding="ISO-8859-1"?>
+//  3. UTF-8
+func newXMLDecoder(r io.Reader, contentType string) *xml.Decoder {
+	if label := contentTypeCharset(contentType); label != "" {
+		if reader, err := charset.NewReaderLabel(label, r); err == nil {
+			decoder := xml.NewDecoder(reader)
+			// already converted to UTF-8, the declaration must not convert it again
+			decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+				return input, nil
+			}
+			return decoder
+		}
+		// unknown label in the header, let the declaration decide
+	}
+
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	return decoder
+}
+
+func contentTypeCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
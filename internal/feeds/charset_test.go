@@ -0,0 +1,65 @@
+package feeds
+
+import "testing"
+
+func TestParseCharset(t *testing.T) {
+	rss := func(declaration, title string) string {
+		return declaration + `<rss version="2.0"><channel><title>` + title + `</title></channel></rss>`
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		doc         string
+		title       string
+	}{
+		{
+			name:        "ISO-8859-1 declaration",
+			contentType: "application/rss+xml",
+			doc:         rss(`<?xml version="1.0" encoding="ISO-8859-1"?>`, "Caf\xe9"),
+			title:       "Café",
+		},
+		{
+			name:        "windows-1252 declaration",
+			contentType: "application/rss+xml",
+			doc:         rss(`<?xml version="1.0" encoding="windows-1252"?>`, "\x93Quoted\x94 \x80"),
+			title:       "“Quoted” €",
+		},
+		{
+			name:        "charset in the header only",
+			contentType: "application/rss+xml; charset=ISO-8859-1",
+			doc:         rss(`<?xml version="1.0"?>`, "Caf\xe9"),
+			title:       "Café",
+		},
+		{
+			name:        "header wins over the declaration",
+			contentType: "text/xml; charset=windows-1252",
+			doc:         rss(`<?xml version="1.0" encoding="UTF-8"?>`, "Caf\xe9"),
+			title:       "Café",
+		},
+		{
+			name:        "unknown charset in the header",
+			contentType: "application/rss+xml; charset=bogus",
+			doc:         rss(`<?xml version="1.0" encoding="ISO-8859-1"?>`, "Caf\xe9"),
+			title:       "Café",
+		},
+		{
+			name:        "UTF-8 by default",
+			contentType: "application/rss+xml",
+			doc:         rss("", "Café"),
+			title:       "Café",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.doc), tt.contentType)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got.Title != tt.title {
+				t.Errorf("Title = %q, want %q", got.Title, tt.title)
+			}
+		})
+	}
+}
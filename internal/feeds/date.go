@@ -0,0 +1,121 @@
+package feeds
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	ErrNoDate      = errors.New("item has no date")
+	ErrInvalidDate = errors.New("unrecognized date format")
+)
+
+// Layouts we try in order once the value is normalized (no weekday, numeric
+// zone). "2" accepts one or two digit days and "06" is the RFC 822 two digit
+// year (69-99 → 19xx, 00-68 → 20xx).
+var dateLayouts = []string{
+	// RFC 822 / RFC 1123 without the weekday
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+	"2 Jan 2006 15:04:05 -07:00",
+	"2 January 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05",
+	"2 Jan 2006",
+
+	// ISO 8601 / RFC 3339 (Atom, JSON Feed, dc:date)
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Go only knows the offset of a zone abbreviation if it matches the local
+// zone, otherwise it silently uses +0000. So we swap the ones found in feeds
+// for numeric offsets ourselves. RFC 822 defines the US ones, the rest are
+// the ones that show up in the wild.
+var zoneOffsets = map[string]string{
+	"UT": "+0000", "UTC": "+0000", "GMT": "+0000", "Z": "+0000",
+	"EST": "-0500", "EDT": "-0400",
+	"CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600",
+	"PST": "-0800", "PDT": "-0700",
+	"AKST": "-0900", "AKDT": "-0800",
+	"HST": "-1000",
+	"WET": "+0000", "WEST": "+0100",
+	"BST": "+0100", "IST": "+0530",
+	"CET": "+0100", "CEST": "+0200", "MET": "+0100", "MEST": "+0200",
+	"EET": "+0200", "EEST": "+0300",
+	"MSK": "+0300",
+	"JST": "+0900", "KST": "+0900",
+	"AEST": "+1000", "AEDT": "+1100",
+	"NZST": "+1200", "NZDT": "+1300",
+}
+
+var trailingZone = regexp.MustCompile(`\s([A-Za-z]{1,5})$`)
+
+// ParseDate understands the date formats feeds actually use: RFC 822 with
+// two or four digit years, named or numeric zones, ISO 8601 / RFC 3339, with
+// or without the weekday (which can be localized, e.g. "Lun," or "Mi.,",
+// since we just drop it). Dates without zone are taken as UTC and the result
+// is always returned in UTC.
+//
+// It returns ErrNoDate for an empty value and ErrInvalidDate when nothing
+// matched, the caller decides the fallback.
+func ParseDate(value string) (time.Time, error) {
+	normalized := normalizeDate(value)
+	if normalized == "" {
+		return time.Time{}, ErrNoDate
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, normalized); err == nil {
+			return t.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidDate, value)
+}
+
+func normalizeDate(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+	value = stripWeekday(value)
+
+	// Only zones we know the offset of are swapped. Anything else ("PM",
+	// military zones, stray words) is left in place so no layout matches:
+	// guessing would silently shift the time by hours.
+	if match := trailingZone.FindStringSubmatch(value); match != nil {
+		if offset, ok := zoneOffsets[strings.ToUpper(match[1])]; ok {
+			value = strings.TrimSpace(strings.TrimSuffix(value, match[1]) + offset)
+		}
+	}
+
+	return value
+}
+
+// stripWeekday drops a leading day name ("Mon, ", "Tuesday ", "jue., ") when
+// it's followed by the day of the month. Weekdays add nothing once we have the
+// date and they are the part most often localized or wrong.
+func stripWeekday(value string) string {
+	i := strings.IndexFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if i <= 0 {
+		return value
+	}
+
+	rest := strings.TrimLeft(value[i:], "., ")
+	if rest == "" || !unicode.IsDigit(rune(rest[0])) {
+		return value
+	}
+	return rest
+}
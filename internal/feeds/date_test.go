@@ -0,0 +1,68 @@
+package feeds
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // RFC 3339, UTC
+	}{
+		{"Mon, 02 Jan 2006 15:04:05 -0700", "2006-01-02T22:04:05Z"},
+		{"Mon, 2 Jan 2006 15:04:05 GMT", "2006-01-02T15:04:05Z"},
+		{"Mon, 02 Jan 2006 15:04:05 EST", "2006-01-02T20:04:05Z"},
+		{"Mon, 02 Jan 2006 15:04:05 cest", "2006-01-02T13:04:05Z"},
+		{"02 Jan 06 15:04 +0100", "2006-01-02T14:04:00Z"},
+		{"Lun, 02 Jan 2006 15:04:05 +0000", "2006-01-02T15:04:05Z"},
+		{"jue., 5 Jan 2006 15:04:05 +0000", "2006-01-05T15:04:05Z"},
+		{"Tuesday 3 January 2006 15:04:05 +0000", "2006-01-03T15:04:05Z"},
+		{"  2 Jan   2006  ", "2006-01-02T00:00:00Z"},
+		{"2006-01-02T15:04:05Z", "2006-01-02T15:04:05Z"},
+		{"2006-01-02T15:04:05.123+02:00", "2006-01-02T13:04:05.123Z"},
+		{"2006-01-02T15:04:05+0200", "2006-01-02T13:04:05Z"},
+		{"2006-01-02T15:04Z", "2006-01-02T15:04:00Z"},
+		{"2006-01-02 15:04:05", "2006-01-02T15:04:05Z"},
+		{"2006-01-02 15:04:05 UTC", "2006-01-02T15:04:05Z"},
+		{"2006-01-02", "2006-01-02T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDate(tt.value)
+		if err != nil {
+			t.Errorf("ParseDate(%q) error: %v", tt.value, err)
+			continue
+		}
+		if got.Location() != time.UTC {
+			t.Errorf("ParseDate(%q) location = %v, want UTC", tt.value, got.Location())
+		}
+		if s := got.Format(time.RFC3339Nano); s != tt.want {
+			t.Errorf("ParseDate(%q) = %s, want %s", tt.value, s, tt.want)
+		}
+	}
+}
+
+func TestParseDateErrors(t *testing.T) {
+	tests := []struct {
+		value string
+		want  error
+	}{
+		{"", ErrNoDate},
+		{"   ", ErrNoDate},
+		{"yesterday", ErrInvalidDate},
+		{"2006-13-45", ErrInvalidDate},
+		// unknown trailing words must not be dropped, that would shift the time
+		{"2022-12-11 10:00:00 PM", ErrInvalidDate},
+		{"Mon, 02 Jan 2006 15:04:05 A", ErrInvalidDate},
+		{"Mon, 02 Jan 2006 15:04:05 XYZ", ErrInvalidDate},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseDate(tt.value)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("ParseDate(%q) = %v, %v; want error %v", tt.value, got, err, tt.want)
+		}
+	}
+}
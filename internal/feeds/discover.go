@@ -0,0 +1,185 @@
+package feeds
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Candidate is a feed found by Discover.
+type Candidate struct {
+	URL   string
+	Title string
+	Type  string
+}
+
+// Media types advertised by <link rel="alternate"> for feeds.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// Discover fetches the URL and returns the feeds behind it.
+//   - URL is already a feed → that URL is the only candidate
+//   - URL is an HTML page   → every <link rel="alternate"> pointing to a feed, hrefs resolved
+//
+// An empty list means the page didn't advertise any feed.
+func Discover(ctx context.Context, pageURL string) ([]Candidate, error) {
+	if err := ValidateURL(pageURL); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create HTTP request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	}
+
+	// after redirects, relative hrefs are relative to where we ended up
+	finalURL := resp.Request.URL
+
+	contentType := resp.Header.Get("Content-Type")
+	if err := checkContentType(contentType); err != nil {
+		return nil, err
+	}
+
+	// one byte over the limit is how we know the document didn't fit. Pages
+	// are only read up to <body>, so a big one is fine if its <head> fits.
+	limited := &io.LimitedReader{R: resp.Body, N: maxBodySize + 1}
+	body := bufio.NewReader(limited)
+
+	// feeds are often served as text/html too, the document has the last word
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if (mediaType == "text/html" || mediaType == "application/xhtml+xml") && !looksLikeFeed(body) {
+		candidates := findFeedLinks(body, finalURL)
+		if limited.N <= 0 {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, maxBodySize)
+		}
+		return candidates, nil
+	}
+
+	feed, err := ParseReader(body, contentType)
+	if limited.N <= 0 {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, maxBodySize)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return []Candidate{{URL: finalURL.String(), Title: feed.Title, Type: mediaType}}, nil
+}
+
+// looksLikeFeed peeks at the start of the document for a feed root element
+// (or a JSON object) showing up before any <html>. Nothing is consumed.
+func looksLikeFeed(body *bufio.Reader) bool {
+	head, _ := body.Peek(1024) // fewer bytes on short documents, that's fine
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		return true
+	}
+
+	lower := bytes.ToLower(head)
+	htmlAt := bytes.Index(lower, []byte("<html"))
+	for _, root := range []string{"<rss", "<feed", "<rdf:rdf"} {
+		if i := bytes.Index(lower, []byte(root)); i >= 0 && (htmlAt < 0 || i < htmlAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// findFeedLinks walks the <head> of the document collecting feed links. We
+// stop at <body> since <link> elements aren't allowed there.
+func findFeedLinks(body io.Reader, base *url.URL) []Candidate {
+	candidates := []Candidate{}
+	seen := map[string]bool{}
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken: // EOF or broken markup, return what we have
+			return candidates
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			switch token.Data {
+			case "body":
+				return candidates
+
+			case "base": // <base href> changes how relative links resolve
+				if href := strings.TrimSpace(attr(token, "href")); href != "" {
+					if resolved, err := base.Parse(href); err == nil {
+						base = resolved
+					}
+				}
+
+			case "link":
+				if !hasRel(attr(token, "rel"), "alternate") {
+					continue
+				}
+
+				linkType := strings.ToLower(strings.TrimSpace(attr(token, "type")))
+				if !feedLinkTypes[linkType] {
+					continue
+				}
+
+				href := strings.TrimSpace(attr(token, "href"))
+				if href == "" {
+					continue
+				}
+				resolved, err := base.Parse(href)
+				if err != nil || seen[resolved.String()] {
+					continue
+				}
+				// a public page must not get us to store an internal feed URL
+				if ValidateURL(resolved.String()) != nil {
+					continue
+				}
+				seen[resolved.String()] = true
+
+				candidates = append(candidates, Candidate{
+					URL:   resolved.String(),
+					Title: attr(token, "title"),
+					Type:  linkType,
+				})
+			}
+		}
+	}
+}
+
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// rel is a space separated, case insensitive list e.g. rel="alternate home"
+func hasRel(rel string, want string) bool {
+	for _, value := range strings.Fields(rel) {
+		if strings.EqualFold(value, want) {
+			return true
+		}
+	}
+	return false
+}
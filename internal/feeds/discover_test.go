@@ -0,0 +1,154 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	list, err := ParseAllowlist("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetAllowlist(list)
+	t.Cleanup(func() { SetAllowlist(Allowlist{}) })
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		path        string // candidate URL path, "" for none
+		title       string
+	}{
+		{
+			name:        "RSS served as text/html",
+			contentType: "text/html; charset=utf-8",
+			body:        `<?xml version="1.0"?><rss version="2.0"><channel><title>Blog</title></channel></rss>`,
+			path:        "/doc",
+			title:       "Blog",
+		},
+		{
+			name:        "Atom served as text/html with BOM",
+			contentType: "text/html",
+			body:        "\xef\xbb\xbf<feed xmlns=\"http://www.w3.org/2005/Atom\"><title>Atom</title></feed>",
+			path:        "/doc",
+			title:       "Atom",
+		},
+		{
+			name:        "JSON Feed served as text/html",
+			contentType: "text/html",
+			body:        `{"version": "https://jsonfeed.org/version/1.1", "title": "JSON"}`,
+			path:        "/doc",
+			title:       "JSON",
+		},
+		{
+			name:        "RSS with the right type",
+			contentType: "application/rss+xml",
+			body:        `<rss version="2.0"><channel><title>Blog</title></channel></rss>`,
+			path:        "/doc",
+			title:       "Blog",
+		},
+		{
+			name:        "page advertising a feed",
+			contentType: "text/html",
+			body:        `<!doctype html><html><head><link rel="alternate" type="application/rss+xml" title="Posts" href="/feed.xml"></head><body><p>&lt;rss&gt;</p></body></html>`,
+			path:        "/feed.xml",
+			title:       "Posts",
+		},
+		{
+			name:        "page mentioning <feed in its text",
+			contentType: "text/html",
+			body:        `<html><head></head><body><pre><feed></pre></body></html>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			candidates, err := Discover(context.Background(), server.URL+"/doc")
+			if err != nil {
+				t.Fatalf("Discover: %v", err)
+			}
+
+			want := []Candidate{}
+			if tt.path != "" {
+				want = []Candidate{{URL: server.URL + tt.path, Title: tt.title}}
+			}
+			for i := range candidates {
+				candidates[i].Type = "" // depends on the case, not what we check here
+			}
+			if !reflect.DeepEqual(candidates, want) {
+				t.Errorf("Discover = %+v, want %+v", candidates, want)
+			}
+		})
+	}
+}
+
+// Documents over the size limit fail instead of being parsed cut, except pages
+// whose <head> fits: nothing after it is read.
+func TestDiscoverTooLarge(t *testing.T) {
+	list, err := ParseAllowlist("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetAllowlist(list)
+	SetMaxBodySize(8 << 10)
+	t.Cleanup(func() {
+		SetAllowlist(Allowlist{})
+		SetMaxBodySize(defaultMaxBodySize)
+	})
+
+	filler := strings.Repeat("x", 16<<10)
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		tooLarge    bool
+	}{
+		{
+			name:        "feed",
+			contentType: "application/rss+xml",
+			body:        `<rss version="2.0"><channel><title>Blog</title><description>` + filler + `</description></channel></rss>`,
+			tooLarge:    true,
+		},
+		{
+			name:        "page with a huge head",
+			contentType: "text/html",
+			body:        `<html><head><title>` + filler + `</title><link rel="alternate" type="application/rss+xml" href="/feed.xml"></head></html>`,
+			tooLarge:    true,
+		},
+		{
+			name:        "page with a huge body",
+			contentType: "text/html",
+			body:        `<html><head><link rel="alternate" type="application/rss+xml" href="/feed.xml"></head><body>` + filler + `</body></html>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			_, err := Discover(context.Background(), server.URL+"/doc")
+			if tt.tooLarge && !errors.Is(err, ErrTooLarge) {
+				t.Errorf("Discover: err = %v, want ErrTooLarge", err)
+			}
+			if !tt.tooLarge && err != nil {
+				t.Errorf("Discover: %v", err)
+			}
+		})
+	}
+}
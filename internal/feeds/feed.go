@@ -0,0 +1,74 @@
+package feeds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Feed is the format-agnostic result of parsing a feed document. Every
+// supported format (RSS 2.0, RSS 1.0/RDF, Atom, JSON Feed) is mapped into it
+// so the scraper doesn't need to care where an item came from.
+type Feed struct {
+	Title       string
+	Link        string
+	Description string
+	Language    string
+	Items       []Item
+	// publisher's hint of how often the feed changes (<ttl>, sy:updatePeriod), 0 if none
+	UpdateInterval time.Duration
+	// WebSub hub pushing updates of this feed and the feed's own URL (topic),
+	// from rel="hub"/rel="self" links. "" if not advertised.
+	Hub  string
+	Self string
+}
+
+type Item struct {
+	ID          string // <guid> for RSS, <id> for Atom, "id" for JSON Feed. Can be empty.
+	Title       string
+	Link        string
+	Description string
+	Content     string   // full body when the format separates it from the summary
+	Authors     []string // author names, if the format has them
+	Categories  []string
+	Comments    string // URL of the comments page
+	ImageURL    string // thumbnail
+	Enclosures  []Enclosure
+	PubDate     string // raw date as found in the document, parsing is up to the caller
+}
+
+// Enclosure is a file attached to an item: podcast audio, video, images...
+type Enclosure struct {
+	URL    string
+	Type   string // MIME type, can be empty
+	Length int64  // bytes, 0 when unknown
+}
+
+// GUID is the identity of the item within its feed. The ID from the document
+// when there is one, otherwise its link: it stays the same when the publisher
+// edits the title or description, so edits are updates (revisions) and not
+// new posts. Items with neither get a hash of their title and description.
+//
+// Keep in sync with the backfill in db/migrations/011_posts_guid.sql.
+func (i Item) GUID() string {
+	if id := strings.TrimSpace(i.ID); id != "" {
+		return id
+	}
+	if link := strings.TrimSpace(i.Link); link != "" {
+		return link
+	}
+
+	// the backfill's hash with an empty url
+	sum := sha256.Sum256([]byte("\n" + i.Title + "\n" + i.Description))
+	return hex.EncodeToString(sum[:])
+}
+
+// ContentHash changes whenever the publisher edits the title, description or
+// body of the item, the scraper uses it to detect updates.
+//
+// Keep in sync with the backfill in db/migrations/012_post_revisions.sql.
+func (i Item) ContentHash() string {
+	sum := sha256.Sum256([]byte(i.Title + "\n" + i.Description + "\n" + i.Content))
+	return hex.EncodeToString(sum[:])
+}
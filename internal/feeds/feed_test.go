@@ -0,0 +1,38 @@
+package feeds
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestItemGUID(t *testing.T) {
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	tests := []struct {
+		name string
+		item Item
+		want string
+	}{
+		{"id wins", Item{ID: " urn:1 ", Link: "https://example.com/1"}, "urn:1"},
+		{"link without id", Item{Link: " https://example.com/1 ", Title: "T"}, "https://example.com/1"},
+		{"hash without id nor link", Item{Link: "  ", Title: "T", Description: "D"}, hash("\nT\nD")},
+		{"nothing at all", Item{}, hash("\n\n")},
+	}
+
+	for _, tt := range tests {
+		if got := tt.item.GUID(); got != tt.want {
+			t.Errorf("%s: GUID() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// editing an item without <guid> must keep its identity
+	before := Item{Link: "https://example.com/1", Title: "Old", Description: "Old"}
+	after := Item{Link: "https://example.com/1", Title: "New", Description: "New"}
+	if before.GUID() != after.GUID() {
+		t.Errorf("GUID changed on edit: %q → %q", before.GUID(), after.GUID())
+	}
+}
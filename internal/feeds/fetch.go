@@ -0,0 +1,236 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Non-2xx answers and refused responses. ErrGone is permanent, the others are
+// worth retrying later.
+var (
+	ErrNotModified = errors.New("feed not modified")
+	ErrGone        = errors.New("feed gone")                 // 410
+	ErrRateLimited = errors.New("rate limited by publisher") // 429, or 503 with Retry-After, see Result.RetryAfter
+	ErrHTTPStatus  = errors.New("unexpected HTTP status")    // any other non-2xx
+	ErrTooLarge    = errors.New("feed too large")
+)
+
+const defaultMaxBodySize = 10 << 20 // 10 MiB, the biggest real feeds are a few MiB
+
+var maxBodySize int64 = defaultMaxBodySize
+
+// SetMaxBodySize caps how much of a response is read, bigger feeds fail with
+// ErrTooLarge. Not safe to call while fetching.
+func SetMaxBodySize(size int64) {
+	maxBodySize = size
+}
+
+// Media types that can't be a feed, no point downloading them.
+var nonFeedMediaTypePrefixes = []string{
+	"image/",
+	"audio/",
+	"video/",
+	"font/",
+	"application/pdf",
+	"application/zip",
+	"application/gzip",
+}
+
+// Validators are the HTTP cache validators of a previous response. Sending
+// them back lets the publisher answer 304 Not Modified instead of the whole
+// document.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// Result is what we learned from fetching a feed.
+type Result struct {
+	Feed       Feed
+	Validators Validators
+	// how long the response can be cached according to Cache-Control/Expires, 0 if not said
+	MaxAge time.Duration
+	// how long the publisher wants us to wait on ErrRateLimited (Retry-After), 0 if not said
+	RetryAfter time.Duration
+	// where we ended up when every redirect on the way was permanent (301/308), "" otherwise
+	PermanentRedirect string
+	// status of the final response and how much of its body we read, 0 without a response
+	StatusCode int
+	BodySize   int64
+}
+
+// UrlToFeed fetches and parses the feed. When the server answers 304 it
+// returns ErrNotModified with the validators we sent and the MaxAge of the
+// 304, there is no Feed to parse. The body is decoded as it streams in and
+// never read past the max body size.
+func UrlToFeed(ctx context.Context, url string, validators Validators) (Result, error) {
+	result := Result{Validators: validators}
+
+	if err := ValidateURL(url); err != nil {
+		return result, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return result, fmt.Errorf("Error creating HTTP request: %v", err)
+	}
+
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return result, fmt.Errorf("Error making HTTP request: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+	result.MaxAge = cacheMaxAge(resp.Header, time.Now())
+	result.PermanentRedirect = permanentRedirect(resp)
+
+	if resp.StatusCode == http.StatusNotModified {
+		return result, ErrNotModified
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return result, fmt.Errorf("%w: %s", ErrGone, resp.Status)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		result.RetryAfter = retryAfter(resp.Header, time.Now())
+		return result, fmt.Errorf("%w: %s", ErrRateLimited, resp.Status)
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		// A 503 is only throttling when it says for how long. Without
+		// Retry-After it's a broken server, a failure like any other so the
+		// feed backs off and eventually gets disabled.
+		result.RetryAfter = retryAfter(resp.Header, time.Now())
+		if result.RetryAfter > 0 {
+			return result, fmt.Errorf("%w: %s", ErrRateLimited, resp.Status)
+		}
+		return result, fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return result, fmt.Errorf("%w: %s", ErrHTTPStatus, resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if err := checkContentType(contentType); err != nil {
+		return result, err
+	}
+
+	if resp.ContentLength > maxBodySize {
+		return result, fmt.Errorf("%w: %d bytes", ErrTooLarge, resp.ContentLength)
+	}
+
+	// one byte over the limit is how we know the body didn't fit
+	body := &io.LimitedReader{R: resp.Body, N: maxBodySize + 1}
+	result.Feed, err = ParseReader(body, contentType)
+	result.BodySize = maxBodySize + 1 - body.N
+	if body.N <= 0 {
+		return result, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, maxBodySize)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	// the Link header wins over the document (WebSub discovery)
+	if hub := linkHeader(resp.Header, "hub", resp.Request.URL); hub != "" {
+		result.Feed.Hub = hub
+	}
+	if self := linkHeader(resp.Header, "self", resp.Request.URL); self != "" {
+		result.Feed.Self = self
+	}
+
+	result.Validators = Validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+	return result, nil
+}
+
+// cacheMaxAge reads how long the publisher wants the response cached.
+// Cache-Control max-age wins over Expires (RFC 9111), no-cache/no-store mean 0.
+func cacheMaxAge(header http.Header, now time.Time) time.Duration {
+	if cacheControl := header.Get("Cache-Control"); cacheControl != "" {
+		for _, directive := range strings.Split(cacheControl, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			switch strings.ToLower(name) {
+			case "no-cache", "no-store":
+				return 0
+			case "max-age":
+				seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+				if err == nil && seconds > 0 {
+					return time.Duration(seconds) * time.Second
+				}
+				return 0
+			}
+		}
+	}
+
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil && expires.After(now) {
+		return expires.Sub(now)
+	}
+
+	return 0
+}
+
+// permanentRedirect walks back the redirects that led to resp. One temporary
+// redirect in the chain means the original URL is still the one to use.
+func permanentRedirect(resp *http.Response) string {
+	if resp.Request.Response == nil {
+		return "" // not redirected
+	}
+
+	for req := resp.Request; req.Response != nil; req = req.Response.Request {
+		switch req.Response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		default:
+			return ""
+		}
+	}
+	return resp.Request.URL.String()
+}
+
+// Retry-After is either seconds or an HTTP date.
+func retryAfter(header http.Header, now time.Time) time.Duration {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// checkContentType rejects what is obviously not a feed. Anything else goes to
+// the parser, plenty of feeds are served as text/plain or text/html.
+func checkContentType(contentType string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil // missing or broken header, let the parser decide
+	}
+
+	for _, prefix := range nonFeedMediaTypePrefixes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return fmt.Errorf("%w: content type %s", ErrUnsupportedFormat, mediaType)
+		}
+	}
+	return nil
+}
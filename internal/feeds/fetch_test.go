@@ -0,0 +1,58 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUrlToFeedThrottling(t *testing.T) {
+	list, err := ParseAllowlist("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetAllowlist(list)
+	t.Cleanup(func() { SetAllowlist(Allowlist{}) })
+
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		wantErr    error
+		wantRetry  time.Duration
+	}{
+		{"429 with Retry-After", http.StatusTooManyRequests, "120", ErrRateLimited, 2 * time.Minute},
+		{"429 without Retry-After", http.StatusTooManyRequests, "", ErrRateLimited, 0},
+		{"503 with Retry-After", http.StatusServiceUnavailable, "60", ErrRateLimited, time.Minute},
+		// a broken server, not throttling: it has to count as a failure
+		{"503 without Retry-After", http.StatusServiceUnavailable, "", ErrHTTPStatus, 0},
+		{"503 with garbage Retry-After", http.StatusServiceUnavailable, "soon", ErrHTTPStatus, 0},
+		{"500", http.StatusInternalServerError, "60", ErrHTTPStatus, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			result, err := UrlToFeed(context.Background(), server.URL, Validators{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if result.RetryAfter != tt.wantRetry {
+				t.Errorf("RetryAfter = %s, want %s", result.RetryAfter, tt.wantRetry)
+			}
+			if result.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", result.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package feeds
+
+import (
+	"strings"
+)
+
+// https://jsonfeed.org/version/1.1
+const jsonFeedVersionPrefix = "https://jsonfeed.org/version/"
+
+type JSONFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description"`
+	Language    string         `json:"language"`
+	Items       []JSONFeedItem `json:"items"`
+	Hubs        []JSONFeedHub  `json:"hubs"`
+}
+
+type JSONFeedHub struct {
+	Type string `json:"type"` // "WebSub", older feeds say "rssCloud" too
+	URL  string `json:"url"`
+}
+
+type JSONFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Author        *JSONFeedAuthor      `json:"author"`  // version 1
+	Authors       []JSONFeedAuthor     `json:"authors"` // version 1.1
+	Tags          []string             `json:"tags"`
+	Image         string               `json:"image"`
+	Attachments   []JSONFeedAttachment `json:"attachments"`
+}
+
+type JSONFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+func (j JSONFeed) toFeed() Feed {
+	feed := Feed{
+		Title:       j.Title,
+		Link:        j.HomePageURL,
+		Description: j.Description,
+		Language:    j.Language,
+		Items:       make([]Item, len(j.Items)),
+		Self:        j.FeedURL,
+	}
+
+	for _, hub := range j.Hubs {
+		if strings.EqualFold(hub.Type, "WebSub") {
+			feed.Hub = hub.URL
+			break
+		}
+	}
+
+	for i, item := range j.Items {
+		content := item.ContentHTML
+		if content == "" {
+			content = item.ContentText
+		}
+
+		description := item.Summary
+		if description == "" {
+			description = content
+		}
+
+		pubDate := item.DatePublished
+		if pubDate == "" {
+			pubDate = item.DateModified
+		}
+
+		// 1.1 deprecated "author" in favor of "authors", feeds in the wild still send either
+		authors := item.Authors
+		if len(authors) == 0 && item.Author != nil {
+			authors = []JSONFeedAuthor{*item.Author}
+		}
+		names := make([]string, 0, len(authors))
+		for _, author := range authors {
+			if author.Name != "" {
+				names = append(names, author.Name)
+			}
+		}
+
+		// title is optional in JSON Feed (microblogs don't have one)
+		title := item.Title
+		if title == "" {
+			title = truncate(item.ContentText, 100)
+		}
+
+		enclosures := make([]Enclosure, len(item.Attachments))
+		for j, attachment := range item.Attachments {
+			enclosures[j] = Enclosure{
+				URL:    attachment.URL,
+				Type:   attachment.MimeType,
+				Length: max(attachment.SizeInBytes, 0),
+			}
+		}
+
+		feed.Items[i] = Item{
+			ID:          item.ID,
+			Title:       title,
+			Link:        item.URL,
+			Description: description,
+			Content:     content,
+			Authors:     names,
+			Categories:  trimAll(item.Tags),
+			ImageURL:    item.Image,
+			Enclosures:  mergeEnclosures(enclosures),
+			PubDate:     strings.TrimSpace(pubDate),
+		}
+	}
+
+	return feed
+}
+
+func truncate(s string, max int) string {
+	s = strings.TrimSpace(s)
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max]) + "…"
+}
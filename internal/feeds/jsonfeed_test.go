@@ -0,0 +1,112 @@
+package feeds
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONFeed(t *testing.T) {
+	tests := []struct {
+		name        string
+		doc         string
+		contentType string
+		want        Feed
+	}{
+		{
+			name:        "version 1.1",
+			contentType: "application/feed+json",
+			doc: `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Example",
+  "home_page_url": "https://example.com/",
+  "feed_url": "https://example.com/feed.json",
+  "description": "All the news",
+  "language": "en",
+  "hubs": [{"type": "rssCloud", "url": "https://cloud.example.com/"}, {"type": "WebSub", "url": "https://hub.example.com/"}],
+  "items": [{
+    "id": "1",
+    "url": "https://example.com/1",
+    "title": "First",
+    "summary": "Teaser",
+    "content_html": "<p>Body</p>",
+    "content_text": "Body",
+    "date_published": "2024-01-02T10:00:00Z",
+    "date_modified": "2024-01-03T10:00:00Z",
+    "authors": [{"name": "Ana"}, {"url": "https://bob.example.com/"}],
+    "tags": ["go", " "],
+    "image": "https://example.com/1.jpg",
+    "attachments": [
+      {"url": "https://example.com/1.mp3", "mime_type": "audio/mpeg", "size_in_bytes": 1234},
+      {"url": "https://example.com/1.mp3", "mime_type": "audio/mpeg"},
+      {"url": "https://example.com/2.mp3", "size_in_bytes": -1}
+    ]
+  }]
+}`,
+			want: Feed{
+				Title:       "Example",
+				Link:        "https://example.com/",
+				Description: "All the news",
+				Language:    "en",
+				Hub:         "https://hub.example.com/",
+				Self:        "https://example.com/feed.json",
+				Items: []Item{{
+					ID:          "1",
+					Title:       "First",
+					Link:        "https://example.com/1",
+					Description: "Teaser",
+					Content:     "<p>Body</p>",
+					Authors:     []string{"Ana"},
+					Categories:  []string{"go"},
+					ImageURL:    "https://example.com/1.jpg",
+					Enclosures: []Enclosure{
+						{URL: "https://example.com/1.mp3", Type: "audio/mpeg", Length: 1234},
+						{URL: "https://example.com/2.mp3"},
+					},
+					PubDate: "2024-01-02T10:00:00Z",
+				}},
+			},
+		},
+		{
+			// sniffed from the body, version 1 "author", microblog item without title
+			name:        "version 1 as text/plain",
+			contentType: "text/plain",
+			doc: `
+{
+  "version": "https://jsonfeed.org/version/1",
+  "title": "Microblog",
+  "items": [{
+    "id": "2",
+    "content_text": "` + strings.Repeat("a", 120) + `",
+    "date_modified": "2024-01-03T10:00:00Z",
+    "author": {"name": "Ana"}
+  }]
+}`,
+			want: Feed{
+				Title: "Microblog",
+				Items: []Item{{
+					ID:          "2",
+					Title:       strings.Repeat("a", 100) + "…",
+					Description: strings.Repeat("a", 120),
+					Content:     strings.Repeat("a", 120),
+					Authors:     []string{"Ana"},
+					Categories:  []string{},
+					Enclosures:  []Enclosure{},
+					PubDate:     "2024-01-03T10:00:00Z",
+				}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.doc), tt.contentType)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package feeds
+
+import (
+	"strconv"
+	"strings"
+)
+
+// <enclosure url="..." length="..." type="..."/> from RSS 2.0
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// Media RSS (https://www.rssboard.org/media-rss), used by podcasts, YouTube
+// and most image heavy feeds. Elements can sit directly in the item or be
+// wrapped in <media:group>.
+type MediaContent struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Medium   string `xml:"medium,attr"`
+	FileSize string `xml:"fileSize,attr"`
+}
+
+type MediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+type MediaGroup struct {
+	Contents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type Media struct {
+	Contents   []MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails []MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	Groups     []MediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+}
+
+func (m Media) enclosures() []Enclosure {
+	contents := m.Contents
+	for _, group := range m.Groups {
+		contents = append(contents, group.Contents...)
+	}
+
+	enclosures := []Enclosure{}
+	for _, content := range contents {
+		enclosures = append(enclosures, Enclosure{
+			URL:    strings.TrimSpace(content.URL),
+			Type:   content.Type,
+			Length: parseLength(content.FileSize),
+		})
+	}
+	return enclosures
+}
+
+// thumbnail returns the first thumbnail, or the first image content if
+// the feed has no explicit thumbnail.
+func (m Media) thumbnail() string {
+	thumbnails := m.Thumbnails
+	for _, group := range m.Groups {
+		thumbnails = append(thumbnails, group.Thumbnails...)
+	}
+	for _, thumbnail := range thumbnails {
+		if url := strings.TrimSpace(thumbnail.URL); url != "" {
+			return url
+		}
+	}
+
+	for _, enclosure := range m.enclosures() {
+		if strings.HasPrefix(enclosure.Type, "image/") {
+			return enclosure.URL
+		}
+	}
+	return ""
+}
+
+// mergeEnclosures drops empty and repeated URLs, feeds commonly put the same
+// file in <enclosure> and <media:content>.
+func mergeEnclosures(lists ...[]Enclosure) []Enclosure {
+	merged := []Enclosure{}
+	seen := map[string]bool{}
+	for _, list := range lists {
+		for _, enclosure := range list {
+			if enclosure.URL == "" || seen[enclosure.URL] {
+				continue
+			}
+			seen[enclosure.URL] = true
+			merged = append(merged, enclosure)
+		}
+	}
+	return merged
+}
+
+// Lengths come as strings and publishers put anything in there, "0", "", "-1", "12 MB".
+func parseLength(value string) int64 {
+	length, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || length < 0 {
+		return 0
+	}
+	return length
+}
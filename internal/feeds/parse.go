@@ -0,0 +1,113 @@
+package feeds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported feed format")
+
+// Parse detects the format of the document and maps it into the common Feed
+// model. JSON Feed is picked by the Content-Type header or, since a lot of
+// servers send it as text/plain, by sniffing the body. XML formats are told
+// apart by their root element.
+//
+//	{"version": "https://jsonfeed.org/version/1.1"} → JSON Feed
+//	<rss>                                           → RSS 2.0
+//	<rdf:RDF>                                       → RSS 1.0
+//	<feed xmlns="http://www.w3.org/2005/Atom">      → Atom 1.0
+func Parse(data []byte, contentType string) (Feed, error) {
+	return ParseReader(bytes.NewReader(data), contentType)
+}
+
+// ParseReader is Parse for a stream, the document is decoded as it's read
+// instead of being loaded in memory first.
+func ParseReader(r io.Reader, contentType string) (Feed, error) {
+	buffered := bufio.NewReader(r)
+
+	if isJSON(buffered, contentType) {
+		return parseJSONFeed(buffered)
+	}
+
+	decoder := newXMLDecoder(buffered, contentType)
+	root, err := rootElement(decoder)
+	if err != nil {
+		return Feed{}, err
+	}
+
+	switch {
+	case root.Name.Local == "rss":
+		rssFeed := RSSFeed{}
+		if err := decoder.DecodeElement(&rssFeed, &root); err != nil {
+			return Feed{}, fmt.Errorf("parse RSS: %w", err)
+		}
+		return rssFeed.toFeed(), nil
+
+	case root.Name.Space == rdfNamespace && root.Name.Local == "RDF":
+		rdfFeed := RDFFeed{}
+		if err := decoder.DecodeElement(&rdfFeed, &root); err != nil {
+			return Feed{}, fmt.Errorf("parse RDF: %w", err)
+		}
+		return rdfFeed.toFeed(), nil
+
+	case root.Name.Space == atomNamespace && root.Name.Local == "feed":
+		atomFeed := AtomFeed{}
+		if err := decoder.DecodeElement(&atomFeed, &root); err != nil {
+			return Feed{}, fmt.Errorf("parse Atom: %w", err)
+		}
+		return atomFeed.toFeed(), nil
+	}
+
+	return Feed{}, fmt.Errorf("%w: root element <%s>", ErrUnsupportedFormat, root.Name.Local)
+}
+
+// rootElement reads tokens until the first start element, the decoder is then
+// right where DecodeElement needs it.
+func rootElement(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return xml.StartElement{}, fmt.Errorf("%w: empty document", ErrUnsupportedFormat)
+		}
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+// the first bytes are peeked, not consumed
+func isJSON(buffered *bufio.Reader, contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/feed+json", "application/json":
+		return true
+	}
+
+	head, _ := buffered.Peek(512) // fewer bytes on short documents, that's fine
+	trimmed := bytes.TrimSpace(head)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+func parseJSONFeed(r io.Reader) (Feed, error) {
+	jsonFeed := JSONFeed{}
+	if err := json.NewDecoder(r).Decode(&jsonFeed); err != nil {
+		return Feed{}, fmt.Errorf("parse JSON Feed: %w", err)
+	}
+
+	if !strings.HasPrefix(jsonFeed.Version, jsonFeedVersionPrefix) {
+		return Feed{}, fmt.Errorf("%w: JSON document with version %q", ErrUnsupportedFormat, jsonFeed.Version)
+	}
+
+	return jsonFeed.toFeed(), nil
+}
@@ -0,0 +1,69 @@
+package feeds
+
+import (
+	"strings"
+)
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// RSS 1.0 is RDF, unlike RSS 2.0 the items are siblings of <channel> under
+// <rdf:RDF> and dates/authors come from the Dublin Core module.
+type RDFFeed struct {
+	Channel struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		Language    string `xml:"http://purl.org/dc/elements/1.1/ language"`
+		Syndication
+	} `xml:"channel"`
+	Item []RDFItem `xml:"item"`
+}
+
+type RDFItem struct {
+	About       string   `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# about,attr"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Creator     []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subject     []string `xml:"http://purl.org/dc/elements/1.1/ subject"`
+}
+
+func (r RDFFeed) toFeed() Feed {
+	feed := Feed{
+		Title:       strings.TrimSpace(r.Channel.Title),
+		Link:        strings.TrimSpace(r.Channel.Link),
+		Description: strings.TrimSpace(r.Channel.Description),
+		Language:    strings.TrimSpace(r.Channel.Language),
+		Items:       make([]Item, len(r.Item)),
+
+		UpdateInterval: r.Channel.Syndication.updateInterval(),
+	}
+
+	for i, item := range r.Item {
+		// rdf:about is the item URI, it's mandatory in RSS 1.0 and usually equals the link
+		feed.Items[i] = Item{
+			ID:          strings.TrimSpace(item.About),
+			Title:       strings.TrimSpace(item.Title),
+			Link:        strings.TrimSpace(item.Link),
+			Description: strings.TrimSpace(item.Description),
+			Content:     strings.TrimSpace(item.Content),
+			Authors:     trimAll(item.Creator),
+			Categories:  trimAll(item.Subject),
+			PubDate:     strings.TrimSpace(item.Date),
+		}
+	}
+
+	return feed
+}
+
+func trimAll(values []string) []string {
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			trimmed = append(trimmed, value)
+		}
+	}
+	return trimmed
+}
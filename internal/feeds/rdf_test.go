@@ -0,0 +1,87 @@
+package feeds
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRDF(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want Feed
+	}{
+		{
+			name: "dublin core and syndication",
+			doc: `<?xml version="1.0"?>
+<rdf:RDF
+  xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+  xmlns="http://purl.org/rss/1.0/"
+  xmlns:dc="http://purl.org/dc/elements/1.1/"
+  xmlns:sy="http://purl.org/rss/1.0/modules/syndication/"
+  xmlns:content="http://purl.org/rss/1.0/modules/content/">
+  <channel rdf:about="https://example.com/">
+    <title> Example </title>
+    <link>https://example.com/</link>
+    <description>All the news</description>
+    <dc:language>en</dc:language>
+    <sy:updatePeriod>hourly</sy:updatePeriod>
+    <sy:updateFrequency>2</sy:updateFrequency>
+  </channel>
+  <item rdf:about="https://example.com/1">
+    <title>First</title>
+    <link> https://example.com/1 </link>
+    <description>Teaser</description>
+    <content:encoded>&lt;p&gt;Body&lt;/p&gt;</content:encoded>
+    <dc:date>2024-01-02T10:00:00+01:00</dc:date>
+    <dc:creator>Ana</dc:creator>
+    <dc:creator>Bob</dc:creator>
+    <dc:subject>go</dc:subject>
+  </item>
+  <item rdf:about="https://example.com/2">
+    <title>Second</title>
+    <link>https://example.com/2</link>
+  </item>
+</rdf:RDF>`,
+			want: Feed{
+				Title:          "Example",
+				Link:           "https://example.com/",
+				Description:    "All the news",
+				Language:       "en",
+				UpdateInterval: 30 * time.Minute,
+				Items: []Item{
+					{
+						ID:          "https://example.com/1",
+						Title:       "First",
+						Link:        "https://example.com/1",
+						Description: "Teaser",
+						Content:     "<p>Body</p>",
+						Authors:     []string{"Ana", "Bob"},
+						Categories:  []string{"go"},
+						PubDate:     "2024-01-02T10:00:00+01:00",
+					},
+					{
+						ID:         "https://example.com/2",
+						Title:      "Second",
+						Link:       "https://example.com/2",
+						Authors:    []string{},
+						Categories: []string{},
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.doc), "application/rdf+xml")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,55 +1,82 @@
 package feeds
 
 import (
-	"context"
-	"encoding/xml"
-	"fmt"
-	"io"
-	"net/http"
+	"strings"
 )
 
 type RSSFeed struct {
 	Channel struct {
+		// <atom:link rel="hub|self">, declared before Link so they don't end
+		// up in it: the first field matching an element wins
+		AtomLinks []AtomLink `xml:"http://www.w3.org/2005/Atom link"`
+
 		Title       string    `xml:"title"`
 		Link        string    `xml:"link"`
 		Description string    `xml:"description"`
 		Language    string    `xml:"language"`
 		Item        []RSSItem `xml:"item"`
+		Syndication
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title          string         `xml:"title"`
+	Link           string         `xml:"link"`
+	Description    string         `xml:"description"`
+	ContentEncoded string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate        string         `xml:"pubDate"`
+	Guid           string         `xml:"guid"`
+	Author         string         `xml:"author"`
+	Creator        []string       `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories     []string       `xml:"category"`
+	Comments       string         `xml:"comments"`
+	Enclosures     []RSSEnclosure `xml:"enclosure"`
+	Media
 }
 
-func UrlToFeed(ctx context.Context, url string) (RSSFeed, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return RSSFeed{}, fmt.Errorf("Error creating HTTP request: %v", err)
-	}
-
-	httpClient := http.Client{} // no need to set timeout, we have context with timeout in parent function
+func (r RSSFeed) toFeed() Feed {
+	feed := Feed{
+		Title:       r.Channel.Title,
+		Link:        r.Channel.Link,
+		Description: r.Channel.Description,
+		Language:    r.Channel.Language,
+		Items:       make([]Item, len(r.Channel.Item)),
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return RSSFeed{}, fmt.Errorf("Error making HTTP request: %v", err)
+		UpdateInterval: r.Channel.Syndication.updateInterval(),
+		Hub:            linkWithRel(r.Channel.AtomLinks, "hub"),
+		Self:           linkWithRel(r.Channel.AtomLinks, "self"),
 	}
 
-	defer resp.Body.Close()
+	for i, item := range r.Channel.Item {
+		enclosures := make([]Enclosure, len(item.Enclosures))
+		for j, enclosure := range item.Enclosures {
+			enclosures[j] = Enclosure{
+				URL:    strings.TrimSpace(enclosure.URL),
+				Type:   enclosure.Type,
+				Length: parseLength(enclosure.Length),
+			}
+		}
 
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return RSSFeed{}, err
-	}
+		// <author> is supposed to be an email, most feeds use dc:creator for the name
+		authors := trimAll(item.Creator)
+		if len(authors) == 0 {
+			authors = trimAll([]string{item.Author})
+		}
 
-	rssFeed := RSSFeed{}
-	err = xml.Unmarshal(data, &rssFeed)
-	if err != nil {
-		return RSSFeed{}, err
+		feed.Items[i] = Item{
+			ID:          item.Guid,
+			Title:       item.Title,
+			Link:        item.Link,
+			Description: item.Description,
+			Content:     strings.TrimSpace(item.ContentEncoded),
+			Authors:     authors,
+			Categories:  trimAll(item.Categories),
+			Comments:    strings.TrimSpace(item.Comments),
+			ImageURL:    item.Media.thumbnail(),
+			Enclosures:  mergeEnclosures(enclosures, item.Media.enclosures()),
+			PubDate:     item.PubDate,
+		}
 	}
 
-	return rssFeed, nil
+	return feed
 }
@@ -0,0 +1,221 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrBlockedURL is returned for URLs we refuse to fetch: feed URLs come from
+// users and the scraper runs inside our network (SSRF).
+var ErrBlockedURL = errors.New("URL not allowed")
+
+var ErrTooManyRedirects = errors.New("too many redirects")
+
+const maxRedirects = 5
+
+// Ranges not covered by the netip helpers (loopback, private, link-local,
+// multicast, unspecified), see isBlockedAddr.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // TEST-NET-1
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // TEST-NET-2
+	netip.MustParsePrefix("203.0.113.0/24"),  // TEST-NET-3
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, can point at any IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local NAT64
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+}
+
+// Allowlist lets internal feeds through the SSRF checks.
+type Allowlist struct {
+	hosts    map[string]bool
+	prefixes []netip.Prefix
+}
+
+// ParseAllowlist reads comma separated hostnames, IPs and CIDRs, e.g.
+// "feeds.internal, 10.1.2.3, 10.20.0.0/16".
+func ParseAllowlist(value string) (Allowlist, error) {
+	list := Allowlist{hosts: map[string]bool{}}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			list.prefixes = append(list.prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			list.prefixes = append(list.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		if strings.ContainsAny(entry, "/:") {
+			return Allowlist{}, fmt.Errorf("invalid allowlist entry %q", entry)
+		}
+		list.hosts[entry] = true
+	}
+	return list, nil
+}
+
+func (a Allowlist) allowsHost(host string) bool {
+	return a.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+}
+
+func (a Allowlist) allowsAddr(addr netip.Addr) bool {
+	for _, prefix := range a.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// set once at startup with SetAllowlist, before anything is fetched
+var allowlist Allowlist
+
+// SetAllowlist replaces the hosts and ranges allowed despite the SSRF checks.
+// Not safe to call while fetching.
+func SetAllowlist(a Allowlist) {
+	allowlist = a
+}
+
+func isBlockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap() // ::ffff:127.0.0.1 is 127.0.0.1
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateURL checks what can be checked without resolving the host: scheme,
+// host and IP literals. Hostnames are checked again on every connection
+// since DNS can change between now and the fetch.
+func ValidateURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBlockedURL, err)
+	}
+
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be http or https", ErrBlockedURL)
+	}
+
+	host := parsed.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: missing host", ErrBlockedURL)
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("%w: credentials in URL", ErrBlockedURL)
+	}
+	if allowlist.allowsHost(host) {
+		return nil
+	}
+
+	lowerHost := strings.ToLower(strings.TrimSuffix(host, "."))
+	if lowerHost == "localhost" || strings.HasSuffix(lowerHost, ".localhost") {
+		return fmt.Errorf("%w: %s is local", ErrBlockedURL, host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil && isBlockedAddr(addr) && !allowlist.allowsAddr(addr.Unmap()) {
+		return fmt.Errorf("%w: %s is an internal address", ErrBlockedURL, host)
+	}
+
+	return nil
+}
+
+// safeDialContext resolves the host itself and connects to the checked IP, so
+// a DNS answer changing between the check and the connection (rebinding)
+// can't get us anywhere else.
+func safeDialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+
+		hostAllowed := allowlist.allowsHost(host)
+		checked := []netip.Addr{}
+		for _, addr := range addrs {
+			addr = addr.Unmap()
+			if isBlockedAddr(addr) && !hostAllowed && !allowlist.allowsAddr(addr) {
+				// one internal answer is enough to distrust the whole name. The
+				// address stays in our logs: the error ends up in API responses
+				// and last_error, it would map our network for whoever asks.
+				log.Printf("Blocked connection to %s: resolves to internal address %s", host, addr)
+				return nil, fmt.Errorf("%w: %s resolves to an internal address", ErrBlockedURL, host)
+			}
+			checked = append(checked, addr)
+		}
+		if len(checked) == 0 {
+			return nil, fmt.Errorf("no address found for %s", host)
+		}
+
+		var dialErr error
+		for _, addr := range checked {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			dialErr = err
+		}
+		return nil, dialErr
+	}
+}
+
+// checkRedirect runs ValidateURL on every hop, the dialer covers the rest.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > maxRedirects {
+		return fmt.Errorf("%w: more than %d", ErrTooManyRedirects, maxRedirects)
+	}
+	return ValidateURL(req.URL.String())
+}
+
+func newSafeClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 nil, // a proxy would resolve and connect for us, skipping the checks
+			DialContext:           safeDialContext(dialer),
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+		},
+		CheckRedirect: checkRedirect,
+		// no need to set timeout, callers pass a context with timeout
+	}
+}
+
+// shared by UrlToFeed and Discover, every user-submitted URL goes through it
+var httpClient = newSafeClient()
@@ -0,0 +1,25 @@
+package feeds
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+// The error of a blocked dial reaches API responses and feeds.last_error, it
+// must not tell what the name resolved to.
+func TestSafeDialBlockedError(t *testing.T) {
+	dial := safeDialContext(&net.Dialer{})
+
+	_, err := dial(context.Background(), "tcp", "localhost:80")
+	if !errors.Is(err, ErrBlockedURL) {
+		t.Fatalf("dial localhost: err = %v, want ErrBlockedURL", err)
+	}
+	for _, addr := range []string{"127.0.0.1", "::1"} {
+		if strings.Contains(err.Error(), addr) {
+			t.Errorf("error %q leaks the resolved address %s", err, addr)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package feeds
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Syndication holds the publisher's hints of how often the feed changes:
+// <ttl> from RSS 2.0 (minutes) and the sy: module (sy:updatePeriod + sy:updateFrequency).
+type Syndication struct {
+	TTL             string `xml:"ttl"`
+	UpdatePeriod    string `xml:"http://purl.org/rss/1.0/modules/syndication/ updatePeriod"`
+	UpdateFrequency string `xml:"http://purl.org/rss/1.0/modules/syndication/ updateFrequency"`
+}
+
+var updatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// updateInterval returns the longest of the hints, 0 when there are none.
+// "hourly" with frequency 2 means twice an hour → 30 minutes.
+func (s Syndication) updateInterval() time.Duration {
+	var interval time.Duration
+
+	if minutes, err := strconv.Atoi(strings.TrimSpace(s.TTL)); err == nil && minutes > 0 {
+		interval = time.Duration(minutes) * time.Minute
+	}
+
+	if period, ok := updatePeriods[strings.ToLower(strings.TrimSpace(s.UpdatePeriod))]; ok {
+		frequency, err := strconv.Atoi(strings.TrimSpace(s.UpdateFrequency))
+		if err != nil || frequency < 1 {
+			frequency = 1 // spec default
+		}
+		interval = max(interval, period/time.Duration(frequency))
+	}
+
+	return interval
+}
@@ -0,0 +1,119 @@
+package feeds
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WebSub (https://www.w3.org/TR/websub/) lets a hub push new content of a
+// feed to us instead of us polling it.
+//
+//	1. Subscribe  → POST hub.mode=subscribe to the hub, it answers 202
+//	2. Verify     → the hub GETs our callback with hub.challenge, we echo it back
+//	3. Distribute → the hub POSTs the new feed content to our callback, signed
+//	                with the secret we gave it (X-Hub-Signature)
+
+// Subscribe asks the hub to push the topic to callback. The hub confirms
+// later by calling the callback (verification of intent), a nil error only
+// means the request was accepted.
+func Subscribe(ctx context.Context, hubURL, topic, callback, secret string, lease time.Duration) error {
+	if err := ValidateURL(hubURL); err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topic},
+		"hub.callback":      {callback},
+		"hub.secret":        {secret},
+		"hub.lease_seconds": {strconv.Itoa(int(lease.Seconds()))},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hubURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("create subscribe request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("make subscribe request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%w: hub answered %s", ErrHTTPStatus, resp.Status)
+	}
+	return nil
+}
+
+// Algorithms a hub may sign with, the spec allows all of them.
+var signatureHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// VerifySignature checks the X-Hub-Signature header ("sha256=<hex hmac>") of
+// a content push against the secret of the subscription.
+func VerifySignature(signature string, secret string, body []byte) bool {
+	algorithm, expected, ok := strings.Cut(signature, "=")
+	if !ok {
+		return false
+	}
+
+	newHash, ok := signatureHashes[strings.ToLower(algorithm)]
+	if !ok {
+		return false
+	}
+
+	expectedMAC, err := hex.DecodeString(expected)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expectedMAC)
+}
+
+// linkHeader returns the first URL of the Link header with the given rel,
+// e.g. `<https://hub.example.com/>; rel="hub"`. Relative URLs are resolved
+// against base.
+func linkHeader(header http.Header, rel string, base *url.URL) string {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			target, params, ok := strings.Cut(strings.TrimSpace(link), ";")
+			target = strings.TrimSpace(target)
+			if !ok || !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range strings.Split(params, ";") {
+				name, values, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(name, "rel") || !hasRel(strings.Trim(values, `"`), rel) {
+					continue
+				}
+
+				resolved, err := base.Parse(strings.Trim(target, "<>"))
+				if err != nil {
+					break
+				}
+				return resolved.String()
+			}
+		}
+	}
+	return ""
+}
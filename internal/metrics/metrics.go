@@ -0,0 +1,276 @@
+// Package metrics keeps counters, gauges and histograms in memory and writes
+// them in the Prometheus text exposition format, for /metrics. It's the small
+// subset of the Prometheus client we need, without the dependency.
+//
+// Metrics are declared as package vars where they're updated, e.g.
+//
+//	var fetchesTotal = metrics.NewCounter("rss_scraper_fetches_total", "Feed fetches by outcome.", "outcome")
+//	fetchesTotal.Inc("success")
+//
+// Label values are given in the order the label names were declared.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType of what Write outputs.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Buckets for durations in seconds, from 5ms to 25s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 25}
+
+type metric interface {
+	write(w io.Writer) error
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []metric // in declaration order, so is the output
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, m)
+}
+
+// Write writes every metric declared so far in the text exposition format.
+func Write(w io.Writer) error {
+	registryMu.Lock()
+	metrics := slices.Clone(registry)
+	registryMu.Unlock()
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// desc is what every kind of metric has: a name, its help and label names.
+// Series are keyed by their label values joined with \xff (can't be in
+// valid UTF-8, so no collision).
+type desc struct {
+	name   string
+	help   string
+	kind   string // counter, gauge or histogram
+	labels []string
+}
+
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s wants %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (d *desc) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+	return err
+}
+
+// labelPairs formats {a="1",b="2"}, extra is appended as is (le for buckets).
+func (d *desc) labelPairs(key string, extra string) string {
+	pairs := []string{}
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escapeLabelValue(value)+`"`)
+		}
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// values is a set of series with one value each, counters and gauges.
+type values struct {
+	desc
+	mu     sync.Mutex
+	series map[string]float64
+}
+
+func (v *values) add(delta float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.series[key] += delta
+}
+
+func (v *values) write(w io.Writer) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.writeHeader(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(v.series) {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelPairs(key, ""), formatValue(v.series[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newValues(name, help, kind string, labels []string) *values {
+	v := &values{desc: desc{name: name, help: help, kind: kind, labels: labels}, series: map[string]float64{}}
+	if len(labels) == 0 {
+		v.series[""] = 0 // unlabelled metrics show up before anything happens
+	}
+	register(v)
+	return v
+}
+
+// Counter only goes up, e.g. requests served.
+type Counter struct{ v *values }
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{v: newValues(name, help, "counter", labels)}
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.v.add(1, labelValues)
+}
+
+// Add panics on negative values, use a Gauge for what can go down.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("metrics: counter %s can't go down", c.v.name))
+	}
+	c.v.add(delta, labelValues)
+}
+
+// Gauge goes up and down, e.g. busy workers.
+type Gauge struct{ v *values }
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{v: newValues(name, help, "gauge", labels)}
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	key := g.v.key(labelValues)
+	g.v.mu.Lock()
+	defer g.v.mu.Unlock()
+	g.v.series[key] = value
+}
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.v.add(delta, labelValues)
+}
+
+// Histogram counts observations in buckets, e.g. request durations.
+type Histogram struct {
+	desc
+	buckets []float64 // upper bounds, ascending, +Inf is implied
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: slices.Sorted(slices.Values(buckets)),
+		series:  map[string]*histogramSeries{},
+	}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = series
+	}
+
+	if i, _ := slices.BinarySearch(h.buckets, value); i < len(h.buckets) {
+		series.counts[i]++
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+		var cumulative uint64
+		for i, upperBound := range h.buckets {
+			cumulative += series.counts[i]
+			le := `le="` + formatValue(upperBound) + `"`
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(key, le), cumulative); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.name, h.labelPairs(key, `le="+Inf"`), series.count,
+			h.name, h.labelPairs(key, ""), formatValue(series.sum),
+			h.name, h.labelPairs(key, ""), series.count,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,180 @@
+package tasks
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule says when a job runs next. Slots are in UTC and the same on every
+// instance, that's how they agree on which run is which (job_runs).
+type schedule interface {
+	// next slot strictly after t, zero if there's none
+	next(t time.Time) time.Time
+}
+
+// parseSchedule reads a cron expression, "minute hour day-of-month month
+// day-of-week" with *, lists (1,15), ranges (1-5) and steps (*/10), e.g.
+// "30 3 * * *" every day at 03:30 UTC. Also @hourly, @daily, @weekly,
+// @monthly and "@every <duration>" (at least a minute, aligned on the Unix epoch).
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	if value, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+		if every < time.Minute {
+			return nil, fmt.Errorf("schedule %q: less than a minute apart", spec)
+		}
+		return everySchedule(every), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: want 5 fields (minute hour day month weekday), got %d", spec, len(fields))
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("schedule %q: minute: %w", spec, err)
+	}
+	if s.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("schedule %q: hour: %w", spec, err)
+	}
+	if s.days, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("schedule %q: day of month: %w", spec, err)
+	}
+	if s.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("schedule %q: month: %w", spec, err)
+	}
+	if s.weekdays, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("schedule %q: day of week: %w", spec, err)
+	}
+	if s.weekdays&(1<<7) != 0 { // 7 is Sunday too
+		s.weekdays |= 1
+	}
+	s.anyDay = fields[2] == "*"
+	s.anyWeekday = fields[4] == "*"
+	return s, nil
+}
+
+// parseCronField returns the values of one field as a bitset.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+		}
+
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = strconv.Atoi(lowPart); err != nil {
+				return 0, fmt.Errorf("bad value in %q", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highPart); err != nil {
+					return 0, fmt.Errorf("bad value in %q", part)
+				}
+			} else if hasStep {
+				high = max // 5/15 is 5-max/15
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64 // bitsets
+	// like cron: when both days and weekdays are restricted, either matches
+	anyDay, anyWeekday bool
+}
+
+// next walks forward, skipping whole months, days and hours that can't match.
+func (s cronSchedule) next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0) // e.g. "0 0 30 2 *" never comes
+
+	for t.Before(limit) {
+		if !has(s.months, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !has(s.hours, t.Hour()) {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !has(s.minutes, t.Minute()) {
+			// jump to the next matching minute of this hour, if any
+			later := s.minutes >> (t.Minute() + 1) << (t.Minute() + 1)
+			if later == 0 {
+				t = t.Truncate(time.Hour).Add(time.Hour)
+			} else {
+				t = t.Truncate(time.Hour).Add(time.Duration(bits.TrailingZeros64(later)) * time.Minute)
+			}
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	day := has(s.days, t.Day())
+	weekday := has(s.weekdays, int(t.Weekday()))
+	if s.anyDay || s.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
+
+func has(set uint64, value int) bool {
+	return set&(1<<value) != 0
+}
+
+// everySchedule runs at multiples of itself since the Unix epoch, not since
+// the instance started, so replicas agree on the slots.
+type everySchedule time.Duration
+
+func (s everySchedule) next(t time.Time) time.Time {
+	// not t.Truncate, that one counts from Go's zero time: slots of durations
+	// not dividing a day wouldn't fall where other tools put them
+	every := int64(s)
+	slot := t.UnixNano() - t.UnixNano()%every
+	return time.Unix(0, slot+every).UTC()
+}
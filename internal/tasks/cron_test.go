@@ -0,0 +1,76 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	date := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"30 3 * * *", date(2024, 1, 2, 10, 0), date(2024, 1, 3, 3, 30)},
+		{"30 3 * * *", date(2024, 1, 2, 3, 29), date(2024, 1, 2, 3, 30)},
+		{"*/15 * * * *", date(2024, 1, 2, 10, 7).Add(30 * time.Second), date(2024, 1, 2, 10, 15)},
+		{"5/20 * * * *", date(2024, 1, 2, 10, 6), date(2024, 1, 2, 10, 25)},
+		{"0,30 8-9 * * *", date(2024, 1, 2, 9, 45), date(2024, 1, 3, 8, 0)},
+		{"0 9 * * 1-5", date(2024, 1, 5, 10, 0), date(2024, 1, 8, 9, 0)}, // Friday to Monday
+		{"0 0 * * 7", date(2024, 1, 2, 10, 0), date(2024, 1, 7, 0, 0)},   // 7 is Sunday
+		{"0 0 13 * 5", date(2024, 1, 2, 10, 0), date(2024, 1, 5, 0, 0)},  // 13th or Friday
+		{"0 0 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"0 0 30 2 *", date(2024, 1, 1, 0, 0), time.Time{}},           // never
+		{"@hourly", date(2024, 1, 2, 10, 0), date(2024, 1, 2, 11, 0)}, // strictly after
+		{"@daily", date(2024, 12, 31, 12, 0), date(2025, 1, 1, 0, 0)},
+		{"@weekly", date(2024, 1, 2, 10, 0), date(2024, 1, 7, 0, 0)},
+		{"@monthly", date(2024, 1, 31, 12, 0), date(2024, 2, 1, 0, 0)},
+		{"@every 15m", date(2024, 1, 2, 10, 7), date(2024, 1, 2, 10, 15)},
+		{"@every 1h", date(2024, 1, 2, 10, 0), date(2024, 1, 2, 11, 0)},
+		{"@every 7m", date(2024, 1, 2, 10, 7), date(2024, 1, 2, 10, 12)}, // from the Unix epoch
+		// slots are in UTC whatever the zone of the time given
+		{"0 9 * * *", time.Date(2024, 1, 2, 10, 0, 0, 0, time.FixedZone("CEST", 2*3600)), date(2024, 1, 2, 9, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec+" from "+tt.from.Format(time.RFC3339), func(t *testing.T) {
+			s, err := parseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("parseSchedule: %v", err)
+			}
+			if got := s.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("next = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@yearly",
+		"@every 30s",
+		"@every soon",
+	} {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := parseSchedule(spec); err == nil {
+				t.Errorf("parseSchedule(%q) = nil error", spec)
+			}
+		})
+	}
+}
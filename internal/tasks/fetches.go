@@ -0,0 +1,60 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// How many runs of each feed feed_fetches keeps, older ones are trimmed as
+// new ones come in. Enough to see when and how a feed started failing.
+const keepFetchesPerFeed = 50
+
+// fetchRun is what scrapeFeed saw, filled in as it goes so failed runs are
+// recorded with whatever we got before the failure (the post counts stay 0,
+// ingestion is all or nothing).
+type fetchRun struct {
+	statusCode int // 0 without a response
+	bytes      int64
+	itemsSeen  int
+	stats      ingestStats
+	merged     bool // the feed was merged into its redirect target and deleted
+}
+
+// recordFetch saves the run in feed_fetches as fetchID, scrapeErr is nil on
+// success.
+func recordFetch(ctx context.Context, db *database.Queries, fetchID, feedID uuid.UUID, run fetchRun, duration time.Duration, scrapeErr error) {
+	var errText sql.NullString
+	if scrapeErr != nil {
+		errText = nullString(scrapeErr.Error())
+	}
+
+	err := db.CreateFeedFetch(ctx, database.CreateFeedFetchParams{
+		ID:            fetchID,
+		FeedID:        feedID,
+		DurationMs:    duration.Milliseconds(),
+		HttpStatus:    sql.NullInt32{Int32: int32(run.statusCode), Valid: run.statusCode != 0},
+		Bytes:         run.bytes,
+		ItemsSeen:     int32(run.itemsSeen),
+		PostsInserted: int32(run.stats.inserted),
+		PostsUpdated:  int32(run.stats.updated),
+		PostsSkipped:  int32(run.stats.skipped),
+		Error:         errText,
+	})
+	if err != nil {
+		log.Printf("Error recording fetch of feed %s: %v", feedID, err)
+		return
+	}
+
+	err = db.TrimFeedFetches(ctx, database.TrimFeedFetchesParams{
+		FeedID: feedID,
+		Keep:   keepFetchesPerFeed,
+	})
+	if err != nil {
+		log.Printf("Error trimming fetches of feed %s: %v", feedID, err)
+	}
+}
@@ -0,0 +1,175 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxHostConnections = 2               // requests in flight to the same host
+	minHostDelay       = 2 * time.Second // between two requests to the same host
+	// a worker doesn't wait longer than this for a host, the feed is
+	// rescheduled instead so the other hosts keep moving
+	maxHostWait = 10 * time.Second
+	// when a 429 doesn't come with Retry-After (a 503 without it is a failure)
+	defaultRetryAfter = 5 * time.Minute
+	// how often hosts nobody is requesting are forgotten
+	hostSweepInterval = 10 * time.Minute
+)
+
+// throttledError means the feed was not fetched because its host asked us to
+// slow down, or we'd have to wait too long for it. It's not the feed's fault.
+type throttledError struct {
+	host  string
+	until time.Time
+	cause error
+}
+
+func (e *throttledError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("host %s throttled until %s: %v", e.host, e.until.Format(time.RFC3339), e.cause)
+	}
+	return fmt.Sprintf("host %s throttled until %s", e.host, e.until.Format(time.RFC3339))
+}
+
+func (e *throttledError) Unwrap() error {
+	return e.cause
+}
+
+type hostState struct {
+	slots       chan struct{} // semaphore, one token per request in flight
+	nextRequest time.Time     // no request before this, minHostDelay or Retry-After
+	users       int           // acquire calls waiting or holding a slot
+}
+
+// hostLimiter keeps the scraper polite with publishers hosting many feeds:
+// at most maxConns requests in flight per host and minDelay between them.
+// It's per instance, several instances each get their own budget.
+type hostLimiter struct {
+	mu        sync.Mutex
+	hosts     map[string]*hostState
+	lastSweep time.Time
+	maxConns  int
+	minDelay  time.Duration
+}
+
+func newHostLimiter(maxConns int, minDelay time.Duration) *hostLimiter {
+	return &hostLimiter{
+		hosts:    map[string]*hostState{},
+		maxConns: maxConns,
+		minDelay: minDelay,
+	}
+}
+
+// feeds on www.example.com and example.com are counted apart, good enough
+func hostOf(feedURL string) string {
+	parsed, err := url.Parse(feedURL)
+	if err != nil {
+		return feedURL
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// state returns the host's state, creating it if needed. l.mu must be held.
+func (l *hostLimiter) state(host string, now time.Time) *hostState {
+	if now.Sub(l.lastSweep) >= hostSweepInterval {
+		l.sweep(now)
+	}
+
+	state, ok := l.hosts[host]
+	if !ok {
+		state = &hostState{slots: make(chan struct{}, l.maxConns)}
+		l.hosts[host] = state
+	}
+	return state
+}
+
+// sweep forgets the hosts nobody is using and that can be requested right
+// away: a fresh state for them would be the same. Without it the map grows
+// with every host ever fetched. l.mu must be held.
+func (l *hostLimiter) sweep(now time.Time) {
+	for host, state := range l.hosts {
+		if state.users == 0 && !state.nextRequest.After(now) {
+			delete(l.hosts, host)
+		}
+	}
+	l.lastSweep = now
+}
+
+// acquire waits for a free slot and the host's delay. The returned func must
+// be called once the request is done. A *throttledError is returned instead
+// when the wait would be longer than maxHostWait.
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	// counted as a user until done so the state isn't swept while waited on,
+	// which would let a second state for the same host double its budget
+	l.mu.Lock()
+	state := l.state(host, time.Now())
+	state.users++
+	l.mu.Unlock()
+	done := func() {
+		l.mu.Lock()
+		state.users--
+		l.mu.Unlock()
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxHostWait)
+	defer cancel()
+
+	select {
+	case state.slots <- struct{}{}:
+	case <-waitCtx.Done():
+		done()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &throttledError{host: host, until: time.Now().Add(l.minDelay)}
+	}
+	release := func() {
+		<-state.slots
+		done()
+	}
+
+	// reserve our turn so the next request is minDelay after ours
+	l.mu.Lock()
+	now := time.Now()
+	start := now
+	if state.nextRequest.After(now) {
+		start = state.nextRequest
+	}
+	if start.Sub(now) > maxHostWait {
+		l.mu.Unlock()
+		release()
+		return nil, &throttledError{host: host, until: start}
+	}
+	state.nextRequest = start.Add(l.minDelay)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(start.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return release, nil
+	case <-ctx.Done():
+		release()
+		return nil, ctx.Err()
+	}
+}
+
+// backOff keeps everyone off the host for d, e.g. after a 429 with Retry-After.
+func (l *hostLimiter) backOff(host string, d time.Duration) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	state := l.state(host, now)
+	until := now.Add(d)
+	if until.After(state.nextRequest) {
+		state.nextRequest = until
+	}
+	return state.nextRequest
+}
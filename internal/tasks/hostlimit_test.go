@@ -0,0 +1,39 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Hosts are forgotten once nobody uses them and their delay has passed, not
+// while a request is in flight or a Retry-After is pending.
+func TestHostLimiterSweep(t *testing.T) {
+	ctx := context.Background()
+	l := newHostLimiter(1, time.Millisecond)
+
+	release, err := l.acquire(ctx, "busy.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	done, err := l.acquire(ctx, "idle.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done()
+	l.backOff("throttled.example.com", time.Hour)
+
+	time.Sleep(5 * time.Millisecond)
+	l.mu.Lock()
+	l.sweep(time.Now())
+	hosts := len(l.hosts)
+	_, busy := l.hosts["busy.example.com"]
+	_, throttled := l.hosts["throttled.example.com"]
+	_, idle := l.hosts["idle.example.com"]
+	l.mu.Unlock()
+
+	if hosts != 2 || !busy || !throttled || idle {
+		t.Errorf("hosts after sweep: busy %v, throttled %v, idle %v; want busy and throttled only", busy, throttled, idle)
+	}
+}
@@ -0,0 +1,172 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
+	"github.com/google/uuid"
+)
+
+// ingestStats is what happened to the items of a feed.
+type ingestStats struct {
+	publishedDates []time.Time // for scheduling
+	inserted       int
+	updated        int
+	skipped        int // already there and unchanged, listed twice, or too old to keep
+}
+
+// ingestItems stores the items of a feed, polled or pushed by a WebSub hub.
+// New and edited items are upserted, unchanged ones are skipped and so are the
+// ones the retention policy would prune right away (see retentionCutoff).
+//
+// It's all or nothing, in one transaction, and a handful of statements
+// whatever the size of the feed: each one takes every item at once as arrays.
+func ingestItems(ctx context.Context, conn *sql.DB, db *database.Queries, feedID uuid.UUID, items []feeds.Item, retention RetentionPolicy) (ingestStats, error) {
+	stats := ingestStats{publishedDates: []time.Time{}}
+
+	cutoff, err := retentionCutoff(ctx, db, feedID, retention)
+	if err != nil {
+		return ingestStats{}, err
+	}
+
+	posts := database.UpsertPostsParams{FeedID: feedID}
+	itemsByGUID := make(map[string]feeds.Item, len(items))
+	for _, item := range items {
+		guid := item.GUID()
+		if _, ok := itemsByGUID[guid]; ok {
+			// one upsert can't touch a row twice, the first one wins
+			stats.skipped++
+			continue
+		}
+		itemsByGUID[guid] = item
+
+		// One bad date must not cost us the rest of the feed. Items without a
+		// usable date get the first-seen time, i.e. when we first scraped them
+		// (UpsertPosts keeps it on updates).
+		publishedAt, err := feeds.ParseDate(item.PubDate)
+		dated := err == nil
+		if !dated {
+			log.Printf("Feed %s item %q: %v, using first-seen time", feedID, item.Link, err)
+			publishedAt = time.Now().UTC()
+		} else {
+			stats.publishedDates = append(stats.publishedDates, publishedAt)
+		}
+		if publishedAt.Before(cutoff) {
+			stats.skipped++
+			continue
+		}
+
+		posts.Ids = append(posts.Ids, uuid.New())
+		posts.Titles = append(posts.Titles, item.Title)
+		posts.Descriptions = append(posts.Descriptions, item.Description)
+		posts.PublishedAts = append(posts.PublishedAts, publishedAt)
+		posts.Urls = append(posts.Urls, item.Link)
+		posts.Contents = append(posts.Contents, item.Content)
+		posts.Authors = append(posts.Authors, strings.Join(item.Authors, ", "))
+		posts.CommentsUrls = append(posts.CommentsUrls, item.Comments)
+		posts.ImageUrls = append(posts.ImageUrls, item.ImageURL)
+		posts.Guids = append(posts.Guids, guid)
+		posts.ContentHashes = append(posts.ContentHashes, item.ContentHash())
+		posts.HasDates = append(posts.HasDates, dated)
+	}
+	if len(posts.Guids) == 0 {
+		return stats, nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return ingestStats{}, fmt.Errorf("begin ingestion of feed %s: %w", feedID, err)
+	}
+	defer tx.Rollback() // no-op once committed
+
+	qtx := db.WithTx(tx)
+
+	adopted, err := qtx.AdoptLegacyPosts(ctx, database.AdoptLegacyPostsParams{
+		Guids:  posts.Guids,
+		Urls:   posts.Urls,
+		FeedID: feedID,
+	})
+	if err != nil {
+		return ingestStats{}, fmt.Errorf("adopt legacy posts of feed %s: %w", feedID, err)
+	}
+	if adopted > 0 {
+		log.Printf("Feed %s: %d posts keyed by their URL re-keyed by guid", feedID, adopted)
+	}
+
+	// keep the current version of edited posts before the upsert overwrites it
+	revisionIDs := make([]uuid.UUID, len(posts.Guids))
+	for i := range revisionIDs {
+		revisionIDs[i] = uuid.New()
+	}
+	err = qtx.CreatePostRevisions(ctx, database.CreatePostRevisionsParams{
+		Ids:           revisionIDs,
+		Guids:         posts.Guids,
+		Titles:        posts.Titles,
+		Descriptions:  posts.Descriptions,
+		ContentHashes: posts.ContentHashes,
+		FeedID:        feedID,
+	})
+	if err != nil {
+		return ingestStats{}, fmt.Errorf("create post revisions for feed %s: %w", feedID, err)
+	}
+
+	upserted, err := qtx.UpsertPosts(ctx, posts)
+	if err != nil {
+		return ingestStats{}, fmt.Errorf("upsert posts for feed %s: %w", feedID, err)
+	}
+
+	// enclosures and categories of new and edited posts only, the others have theirs
+	enclosures := database.CreatePostEnclosuresParams{}
+	categories := database.CreatePostCategoriesParams{}
+	inserted, updated := 0, 0
+	for _, post := range upserted {
+		if post.Inserted {
+			inserted++
+		} else {
+			updated++
+		}
+
+		item := itemsByGUID[post.Guid]
+		for _, enclosure := range item.Enclosures {
+			enclosures.Ids = append(enclosures.Ids, uuid.New())
+			enclosures.PostIds = append(enclosures.PostIds, post.ID)
+			enclosures.Urls = append(enclosures.Urls, enclosure.URL)
+			enclosures.MimeTypes = append(enclosures.MimeTypes, enclosure.Type)
+			enclosures.Lengths = append(enclosures.Lengths, max(enclosure.Length, 0))
+		}
+		for _, category := range item.Categories {
+			categories.PostIds = append(categories.PostIds, post.ID)
+			categories.Names = append(categories.Names, category)
+		}
+	}
+
+	if len(enclosures.Ids) > 0 {
+		if err := qtx.CreatePostEnclosures(ctx, enclosures); err != nil {
+			return ingestStats{}, fmt.Errorf("create enclosures for feed %s: %w", feedID, err)
+		}
+	}
+	if len(categories.PostIds) > 0 {
+		if err := qtx.CreatePostCategories(ctx, categories); err != nil {
+			return ingestStats{}, fmt.Errorf("create categories for feed %s: %w", feedID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return ingestStats{}, fmt.Errorf("commit ingestion of feed %s: %w", feedID, err)
+	}
+
+	stats.inserted = inserted
+	stats.updated = updated
+	stats.skipped += len(posts.Guids) - len(upserted)
+
+	postsIngested.Add(float64(stats.inserted), "inserted")
+	postsIngested.Add(float64(stats.updated), "updated")
+	postsIngested.Add(float64(stats.skipped), "unchanged")
+	return stats, nil
+}
@@ -0,0 +1,371 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to DB_URL, a disposable database with the migrations
+// applied (goose up). Tests needing it are skipped when it's not set.
+func openTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	dbURL := os.Getenv("DB_URL")
+	if dbURL == "" {
+		tb.Skip("DB_URL not set, skipping Postgres test")
+	}
+
+	conn, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	if err := conn.Ping(); err != nil {
+		tb.Fatalf("can't reach DB_URL: %v", err)
+	}
+	return conn
+}
+
+// createTestUser creates a user deleted at the end of the test, with the
+// feeds it owns and its follows.
+func createTestUser(tb testing.TB, conn *sql.DB) uuid.UUID {
+	tb.Helper()
+	db := database.New(conn)
+
+	user, err := db.CreateUser(context.Background(), database.CreateUserParams{ID: uuid.New(), FirstName: "Tasks", LastName: "Test"})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		if _, err := conn.Exec("DELETE FROM users WHERE id = $1", user.ID); err != nil {
+			tb.Errorf("cleanup: %v", err)
+		}
+	})
+	return user.ID
+}
+
+// createTestFeed creates a user owning a feed, both deleted at the end of the
+// test along with the posts.
+func createTestFeed(tb testing.TB, conn *sql.DB) uuid.UUID {
+	tb.Helper()
+	feed, err := database.New(conn).CreateFeed(context.Background(), database.CreateFeedParams{
+		ID:     uuid.New(),
+		Name:   "tasks test",
+		Url:    fmt.Sprintf("https://example.com/%s.xml", uuid.NewString()),
+		UserID: createTestUser(tb, conn),
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return feed.ID
+}
+
+func testItems(prefix string, count int) []feeds.Item {
+	items := make([]feeds.Item, count)
+	for i := range items {
+		link := fmt.Sprintf("https://example.com/%s/%d", prefix, i)
+		items[i] = feeds.Item{
+			ID:          link,
+			Title:       fmt.Sprintf("Post %d", i),
+			Link:        link,
+			Description: "Teaser",
+			Content:     "<p>Body</p>",
+			Authors:     []string{"Ana"},
+			Categories:  []string{"go"},
+			PubDate:     time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC).Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+		}
+	}
+	return items
+}
+
+func TestIngestItemsCounts(t *testing.T) {
+	conn := openTestDB(t)
+	feedID := createTestFeed(t, conn)
+	db := database.New(conn)
+	ctx := context.Background()
+
+	ingest := func(items []feeds.Item) ingestStats {
+		t.Helper()
+		stats, err := ingestItems(ctx, conn, db, feedID, items, RetentionPolicy{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+	check := func(name string, stats ingestStats, inserted, updated, skipped int) {
+		t.Helper()
+		if stats.inserted != inserted || stats.updated != updated || stats.skipped != skipped {
+			t.Errorf("%s: inserted/updated/skipped = %d/%d/%d, want %d/%d/%d",
+				name, stats.inserted, stats.updated, stats.skipped, inserted, updated, skipped)
+		}
+	}
+
+	items := testItems("counts", 3)
+	check("first ingestion", ingest(items), 3, 0, 0)
+	check("same items", ingest(items), 0, 0, 3)
+
+	// the updated row is told from the inserted one by xmax, it must not
+	// count as new
+	items[0].Content = "<p>Edited</p>"
+	items = append(items, testItems("counts-new", 1)...)
+	items = append(items, items[1]) // listed twice
+	check("edit, new and duplicate", ingest(items), 1, 1, 3)
+
+	var posts int
+	if err := conn.QueryRow("SELECT count(*) FROM posts WHERE feed_id = $1", feedID).Scan(&posts); err != nil {
+		t.Fatal(err)
+	}
+	if posts != 4 {
+		t.Errorf("%d posts stored, want 4", posts)
+	}
+}
+
+// Posts from before guids were keyed by their url (migration 011), the item
+// with its real guid must update them instead of duplicating them.
+func TestIngestItemsAdoptsLegacyPosts(t *testing.T) {
+	conn := openTestDB(t)
+	feedID := createTestFeed(t, conn)
+	db := database.New(conn)
+	ctx := context.Background()
+
+	item := testItems("legacy", 1)[0]
+	item.ID = "tag:example.com,2024:1"
+	legacyID := uuid.New()
+	_, err := conn.Exec(`INSERT INTO posts (id, title, published_at, url, feed_id, guid, content_hash)
+VALUES ($1, $2, $3, $4, $5, $4, 'legacy')`, legacyID, item.Title, time.Now().UTC(), item.Link, feedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := ingestItems(ctx, conn, db, feedID, []feeds.Item{item}, RetentionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.inserted != 0 || stats.updated != 1 {
+		t.Errorf("inserted/updated = %d/%d, want 0/1", stats.inserted, stats.updated)
+	}
+
+	var id uuid.UUID
+	var guid string
+	var posts int
+	err = conn.QueryRow("SELECT min(id::text)::uuid, min(guid), count(*) FROM posts WHERE feed_id = $1", feedID).Scan(&id, &guid, &posts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posts != 1 || id != legacyID || guid != item.ID {
+		t.Errorf("posts = %d, id = %s, guid = %q; want 1 post, the legacy one, keyed %q", posts, id, guid, item.ID)
+	}
+}
+
+// An edited item without a usable date keeps its first-seen time, it must not
+// move back to the top of the feed.
+func TestIngestItemsKeepsFirstSeenTime(t *testing.T) {
+	conn := openTestDB(t)
+	feedID := createTestFeed(t, conn)
+	db := database.New(conn)
+	ctx := context.Background()
+
+	item := testItems("undated", 1)[0]
+	item.PubDate = "someday"
+	publishedAt := func() time.Time {
+		t.Helper()
+		var publishedAt time.Time
+		if err := conn.QueryRow("SELECT published_at FROM posts WHERE feed_id = $1", feedID).Scan(&publishedAt); err != nil {
+			t.Fatal(err)
+		}
+		return publishedAt
+	}
+
+	if _, err := ingestItems(ctx, conn, db, feedID, []feeds.Item{item}, RetentionPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	firstSeen := publishedAt()
+
+	time.Sleep(10 * time.Millisecond)
+	item.Content = "<p>Edited</p>"
+	stats, err := ingestItems(ctx, conn, db, feedID, []feeds.Item{item}, RetentionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.updated != 1 {
+		t.Fatalf("updated = %d, want 1", stats.updated)
+	}
+	if got := publishedAt(); !got.Equal(firstSeen) {
+		t.Errorf("published_at = %v after the edit, want the first-seen %v", got, firstSeen)
+	}
+}
+
+// Items the retention would prune right away are not stored, or the next
+// scrape would bring them back after every Prune.
+func TestIngestItemsRetention(t *testing.T) {
+	conn := openTestDB(t)
+	db := database.New(conn)
+	ctx := context.Background()
+
+	ingest := func(feedID uuid.UUID, items []feeds.Item, policy RetentionPolicy) ingestStats {
+		t.Helper()
+		stats, err := ingestItems(ctx, conn, db, feedID, items, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats
+	}
+
+	t.Run("keep days", func(t *testing.T) {
+		feedID := createTestFeed(t, conn)
+		items := testItems("days", 2) // published in 2024
+		items[1].PubDate = time.Now().UTC().Format(time.RFC3339)
+
+		stats := ingest(feedID, items, RetentionPolicy{KeepDays: 30, Floor: 24 * time.Hour})
+		if stats.inserted != 1 || stats.skipped != 1 {
+			t.Errorf("inserted/skipped = %d/%d, want 1/1", stats.inserted, stats.skipped)
+		}
+		// within the floor, kept whatever keep_days says
+		stats = ingest(feedID, items, RetentionPolicy{KeepDays: 30, Floor: 10 * 365 * 24 * time.Hour})
+		if stats.inserted != 1 || stats.skipped != 1 {
+			t.Errorf("with a long floor: inserted/skipped = %d/%d, want 1/1", stats.inserted, stats.skipped)
+		}
+	})
+
+	t.Run("keep posts of the feed's own policy", func(t *testing.T) {
+		feedID := createTestFeed(t, conn)
+		_, err := db.UpsertFeedRetentionPolicy(ctx, database.UpsertFeedRetentionPolicyParams{
+			FeedID:    feedID,
+			KeepPosts: sql.NullInt32{Int32: 2, Valid: true},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		items := testItems("posts", 3) // the last one is the latest
+		if stats := ingest(feedID, items, RetentionPolicy{}); stats.inserted != 3 {
+			t.Fatalf("first ingestion: inserted = %d, want 3", stats.inserted)
+		}
+		for i := range items {
+			items[i].Content = "<p>Edited</p>"
+		}
+		stats := ingest(feedID, items, RetentionPolicy{})
+		if stats.updated != 2 || stats.skipped != 1 {
+			t.Errorf("edited: updated/skipped = %d/%d, want 2/1", stats.updated, stats.skipped)
+		}
+	})
+}
+
+// What ingestion did before the unnest upserts: two statements per item, plus
+// one per category, outside of any transaction.
+const (
+	perRowRevision = `INSERT INTO post_revisions (id, post_id, title, description, content_hash)
+SELECT $1, posts.id, posts.title, posts.description, posts.content_hash
+FROM posts
+WHERE posts.feed_id = $2 AND posts.guid = $3 AND posts.content_hash <> $4`
+	perRowUpsert = `INSERT INTO posts (id, title, description, published_at, url, feed_id, content, author, comments_url, image_url, guid, content_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+ON CONFLICT (feed_id, guid) DO UPDATE
+SET title = EXCLUDED.title,
+description = EXCLUDED.description,
+published_at = EXCLUDED.published_at,
+url = EXCLUDED.url,
+content = EXCLUDED.content,
+author = EXCLUDED.author,
+comments_url = EXCLUDED.comments_url,
+image_url = EXCLUDED.image_url,
+content_hash = EXCLUDED.content_hash,
+updated_at = NOW()
+WHERE posts.content_hash <> EXCLUDED.content_hash
+RETURNING id`
+	perRowCategory = `INSERT INTO post_categories (post_id, name) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+)
+
+func ingestItemsPerRow(ctx context.Context, conn *sql.DB, feedID uuid.UUID, items []feeds.Item) error {
+	for _, item := range items {
+		publishedAt, err := feeds.ParseDate(item.PubDate)
+		if err != nil {
+			publishedAt = time.Now().UTC()
+		}
+		guid, contentHash := item.GUID(), item.ContentHash()
+
+		if _, err := conn.ExecContext(ctx, perRowRevision, uuid.New(), feedID, guid, contentHash); err != nil {
+			return err
+		}
+
+		var postID uuid.UUID
+		err = conn.QueryRowContext(ctx, perRowUpsert,
+			uuid.New(), item.Title, nullString(item.Description), publishedAt, item.Link, feedID,
+			nullString(item.Content), nullString(strings.Join(item.Authors, ", ")), nullString(item.Comments),
+			nullString(item.ImageURL), guid, contentHash,
+		).Scan(&postID)
+		if errors.Is(err, sql.ErrNoRows) {
+			// the feed already has this post and it didn't change
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, category := range item.Categories {
+			if _, err := conn.ExecContext(ctx, perRowCategory, postID, category); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Storing a large feed for the first time, then again unchanged (what most
+// scrapes are), row by row against the unnest upserts.
+func BenchmarkIngestItems(b *testing.B) {
+	conn := openTestDB(b)
+	db := database.New(conn)
+	ctx := context.Background()
+	const feedSize = 500
+
+	benchmarks := []struct {
+		name   string
+		ingest func(feedID uuid.UUID, items []feeds.Item) error
+	}{
+		{"per-row", func(feedID uuid.UUID, items []feeds.Item) error {
+			return ingestItemsPerRow(ctx, conn, feedID, items)
+		}},
+		{"unnest", func(feedID uuid.UUID, items []feeds.Item) error {
+			_, err := ingestItems(ctx, conn, db, feedID, items, RetentionPolicy{})
+			return err
+		}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name+"/new", func(b *testing.B) {
+			feedID := createTestFeed(b, conn)
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				items := testItems(fmt.Sprintf("%s-%d", bm.name, i), feedSize)
+				b.StartTimer()
+				if err := bm.ingest(feedID, items); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(bm.name+"/unchanged", func(b *testing.B) {
+			feedID := createTestFeed(b, conn)
+			items := testItems(bm.name, feedSize)
+			if err := bm.ingest(feedID, items); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := bm.ingest(feedID, items); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// Job is a maintenance task (pruning, digests, rollups...). It gets Run's
+// context and should return soon once it's cancelled.
+type Job func(ctx context.Context) error
+
+// runs of every job older than that are deleted, by the scheduler's own job
+const jobRunsRetention = 30 * 24 * time.Hour
+
+type scheduledJob struct {
+	name     string
+	schedule schedule
+	run      Job
+	lockKey  int64
+}
+
+// Scheduler runs maintenance jobs on their schedule, each slot on exactly one
+// instance however many of them run it:
+//   - a run holds a Postgres advisory lock named after its job, so a slow run
+//     is never overlapped by another instance's next one;
+//   - a run first inserts its (job, slot) row in job_runs, if it's already
+//     there another instance did this slot and we skip it (clock skew).
+//
+// Each run is recorded in job_runs with its error, if any.
+type Scheduler struct {
+	conn       *sql.DB
+	db         *database.Queries
+	instanceID string
+
+	mu      sync.Mutex
+	jobs    []scheduledJob
+	running bool
+}
+
+func NewScheduler(conn *sql.DB) *Scheduler {
+	s := &Scheduler{
+		conn:       conn,
+		db:         database.New(conn),
+		instanceID: newInstanceID(),
+	}
+	// keeps job_runs from growing forever
+	if err := s.Register("prune-job-runs", "15 4 * * *", s.pruneJobRuns); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// Register adds a job, before Run. name identifies it across instances and
+// restarts, spec is a cron expression (see parseSchedule).
+func (s *Scheduler) Register(name, spec string, job Job) error {
+	sched, err := parseSchedule(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return fmt.Errorf("job %s: scheduler already running", name)
+	}
+	for _, j := range s.jobs {
+		if j.name == name {
+			return fmt.Errorf("job %s: already registered", name)
+		}
+	}
+	s.jobs = append(s.jobs, scheduledJob{name: name, schedule: sched, run: job, lockKey: jobLockKey(name)})
+	return nil
+}
+
+// Run runs every job on its schedule until ctx is cancelled, call it once.
+// It returns once the runs in progress are done.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.running = true
+	jobs := s.jobs
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	defer wg.Wait() // WAIT for the runs in progress
+
+	for _, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}()
+	}
+}
+
+// loop sleeps until each slot of the job and runs it. Slots missed while the
+// previous run was still going are skipped, not caught up on.
+func (s *Scheduler) loop(ctx context.Context, job scheduledJob) {
+	for {
+		slot := job.schedule.next(time.Now())
+		if slot.IsZero() {
+			log.Printf("Job %s never runs, its schedule has no next slot", job.name)
+			return
+		}
+
+		timer := time.NewTimer(time.Until(slot))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.runJob(ctx, job, slot)
+	}
+}
+
+// runJob runs one slot of the job if no other instance runs or ran it.
+func (s *Scheduler) runJob(ctx context.Context, job scheduledJob, slot time.Time) {
+	// advisory locks belong to a session, take and release it on one connection
+	conn, err := s.conn.Conn(ctx)
+	if err != nil {
+		log.Printf("Error getting a connection for job %s: %v", job.name, err)
+		return
+	}
+	defer conn.Close()
+	lockDB := database.New(conn)
+
+	locked, err := lockDB.TryAdvisoryLock(ctx, job.lockKey)
+	if err != nil {
+		log.Printf("Error locking job %s: %v", job.name, err)
+		return
+	}
+	if !locked {
+		return // another instance is running it
+	}
+
+	// ctx may be cancelled by now so we need a new one. Back in the pool still
+	// locked, the connection would block the job for good, drop it instead.
+	defer func() {
+		unlockCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		released, err := lockDB.ReleaseAdvisoryLock(unlockCtx, job.lockKey)
+		if err != nil || !released {
+			log.Printf("Error unlocking job %s (released: %v): %v, dropping its connection", job.name, released, err)
+			conn.Raw(func(any) error { return driver.ErrBadConn })
+		}
+	}()
+
+	runID := uuid.New()
+	started, err := s.db.StartJobRun(ctx, database.StartJobRunParams{
+		ID:           runID,
+		JobName:      job.name,
+		ScheduledFor: slot,
+		InstanceID:   s.instanceID,
+	})
+	if err != nil {
+		log.Printf("Error starting job %s: %v", job.name, err)
+		return
+	}
+	if started == 0 {
+		return // another instance already ran this slot
+	}
+
+	start := time.Now()
+	runErr := job.run(ctx)
+	duration := time.Since(start)
+
+	jobRunsTotal.Inc(job.name, jobOutcome(runErr, ctx.Err() != nil))
+	jobDuration.Observe(duration.Seconds(), job.name)
+	if runErr != nil {
+		log.Printf("Job %s failed after %s: %v", job.name, duration, runErr)
+	} else {
+		log.Printf("Job %s done in %s", job.name, duration)
+	}
+
+	var errText sql.NullString
+	if runErr != nil {
+		errText = nullString(runErr.Error())
+	}
+	finishCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.db.FinishJobRun(finishCtx, database.FinishJobRunParams{ID: runID, Error: errText})
+	if err != nil {
+		log.Printf("Error recording run of job %s: %v", job.name, err)
+	}
+}
+
+func (s *Scheduler) pruneJobRuns(ctx context.Context) error {
+	deleted, err := s.db.DeleteJobRunsBefore(ctx, int64(jobRunsRetention.Seconds()))
+	if err != nil {
+		return fmt.Errorf("delete old job runs: %w", err)
+	}
+	log.Printf("Deleted %d job runs older than %s", deleted, jobRunsRetention)
+	return nil
+}
+
+// jobLockKey turns a job name into an advisory lock key. Prefixed so we don't
+// collide with locks taken by anything else sharing the database.
+func jobLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("rss_aggregator:job:" + name))
+	return int64(h.Sum64())
+}
+
+func jobOutcome(err error, canceled bool) string {
+	switch {
+	case err == nil:
+		return "success"
+	case canceled || errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "failed"
+	}
+}
@@ -0,0 +1,59 @@
+package tasks
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
+	"github.com/alepaez-dev/rss_aggregator/internal/metrics"
+)
+
+// Scraper metrics, served on /metrics. A drop of fetchesTotal{outcome="success"}
+// or postsIngested while the queues fill up means ingestion stalled.
+var (
+	fetchesTotal = metrics.NewCounter("rss_scraper_fetches_total",
+		"Feed fetches by outcome (success, not_modified, merged, throttled, gone, failed, canceled).", "outcome")
+	fetchDuration = metrics.NewHistogram("rss_scraper_fetch_duration_seconds",
+		"Time to fetch and store a feed.", metrics.DefaultBuckets)
+	downloadedBytes = metrics.NewCounter("rss_scraper_downloaded_bytes_total",
+		"Feed bytes read.")
+	postsIngested = metrics.NewCounter("rss_posts_ingested_total",
+		"Posts stored, polled or pushed by WebSub hubs, by result (inserted, updated, unchanged).", "result")
+	queueDepth = metrics.NewGauge("rss_scraper_queue_depth",
+		"Feeds waiting for a worker, claimed due feeds and queued refreshes.", "queue")
+	busyWorkers = metrics.NewGauge("rss_scraper_busy_workers",
+		"Workers scraping a feed right now.")
+	workers = metrics.NewGauge("rss_scraper_workers",
+		"Size of the worker pool.")
+)
+
+// Scheduler metrics, only the instance that got to run a slot counts it.
+var (
+	jobRunsTotal = metrics.NewCounter("rss_job_runs_total",
+		"Maintenance job runs by job and outcome (success, failed, canceled).", "job", "outcome")
+	jobDuration = metrics.NewHistogram("rss_job_duration_seconds",
+		"Time a maintenance job run took.", []float64{0.1, 0.5, 1, 5, 15, 60, 300, 900}, "job")
+	postsPruned = metrics.NewCounter("rss_posts_pruned_total",
+		"Posts deleted by the retention policies.")
+)
+
+// fetchOutcome sums up a scrape for fetchesTotal.
+func fetchOutcome(run fetchRun, err error, canceled bool) string {
+	var throttled *throttledError
+	switch {
+	case canceled:
+		return "canceled"
+	case err == nil && run.merged:
+		return "merged"
+	case err == nil && run.statusCode == http.StatusNotModified:
+		return "not_modified"
+	case err == nil:
+		return "success"
+	case errors.As(err, &throttled):
+		return "throttled"
+	case errors.Is(err, feeds.ErrGone):
+		return "gone"
+	default:
+		return "failed"
+	}
+}
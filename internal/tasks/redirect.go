@@ -0,0 +1,101 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// followRedirect moves the feed to where the publisher permanently redirects
+// it, once that happened redirectThreshold fetches in a row. When another feed
+// already has that URL the feed is merged into it and merged is true: the
+// feed doesn't exist anymore.
+func followRedirect(
+	ctx context.Context,
+	conn *sql.DB,
+	db *database.Queries,
+	feed database.Feed,
+	redirectURL string,
+	redirectThreshold int,
+) (merged bool, err error) {
+	if redirectURL == "" || redirectURL == feed.Url {
+		if feed.RedirectCount > 0 { // the redirect is gone, start counting again next time
+			if err := db.ResetFeedRedirect(ctx, feed.ID); err != nil {
+				return false, fmt.Errorf("reset redirect of feed %s: %w", feed.ID, err)
+			}
+		}
+		return false, nil
+	}
+
+	count, err := db.RecordFeedRedirect(ctx, database.RecordFeedRedirectParams{
+		RedirectUrl: redirectURL,
+		ID:          feed.ID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("record redirect of feed %s: %w", feed.ID, err)
+	}
+	if int(count) < redirectThreshold {
+		return false, nil
+	}
+
+	existing, err := db.GetFeedByURL(ctx, redirectURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = db.UpdateFeedURL(ctx, database.UpdateFeedURLParams{
+			ID:  feed.ID,
+			Url: redirectURL,
+		})
+		if err != nil {
+			return false, fmt.Errorf("move feed %s to %s: %w", feed.ID, redirectURL, err)
+		}
+		log.Printf("Feed %s moved from %s to %s", feed.ID, feed.Url, redirectURL)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("get feed by URL %s: %w", redirectURL, err)
+	}
+
+	if err := mergeFeeds(ctx, conn, db, feed.ID, existing.ID); err != nil {
+		return false, fmt.Errorf("merge feed %s into %s: %w", feed.ID, existing.ID, err)
+	}
+	log.Printf("Feed %s (%s) merged into feed %s (%s)", feed.ID, feed.Url, existing.ID, existing.Url)
+	return true, nil
+}
+
+// mergeFeeds moves the follows and posts of a feed to another one and deletes
+// it. All or nothing, a half merged feed would lose followers.
+func mergeFeeds(ctx context.Context, conn *sql.DB, db *database.Queries, fromID, toID uuid.UUID) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op once committed
+
+	qtx := db.WithTx(tx)
+
+	err = qtx.MoveFeedFollows(ctx, database.MoveFeedFollowsParams{ToFeedID: toID, FromFeedID: fromID})
+	if err != nil {
+		return fmt.Errorf("move follows: %w", err)
+	}
+
+	// whoever followed both keeps the follow of the target
+	if err := qtx.DeleteFeedFollowsForFeed(ctx, fromID); err != nil {
+		return fmt.Errorf("delete leftover follows: %w", err)
+	}
+
+	err = qtx.MovePostsToFeed(ctx, database.MovePostsToFeedParams{ToFeedID: toID, FromFeedID: fromID})
+	if err != nil {
+		return fmt.Errorf("move posts: %w", err)
+	}
+
+	// posts the target already had are deleted with the feed (ON DELETE CASCADE)
+	if err := qtx.DeleteFeed(ctx, fromID); err != nil {
+		return fmt.Errorf("delete feed: %w", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,131 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// A feed redirected to the URL of another feed is merged into it once the
+// redirect was seen threshold times in a row: follows and posts move over,
+// without duplicates, and the feed is gone.
+func TestFollowRedirectMerges(t *testing.T) {
+	conn := openTestDB(t)
+	db := database.New(conn)
+	ctx := context.Background()
+
+	fromID, toID := createTestFeed(t, conn), createTestFeed(t, conn)
+	from, err := db.GetFeedByID(ctx, fromID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := db.GetFeedByID(ctx, toID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follow := func(userID, feedID uuid.UUID) {
+		t.Helper()
+		_, err := db.CreateFeedFollow(ctx, database.CreateFeedFollowParams{ID: uuid.New(), UserID: userID, FeedID: feedID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	onlyFrom, both := createTestUser(t, conn), createTestUser(t, conn)
+	follow(onlyFrom, fromID)
+	follow(both, fromID)
+	follow(both, toID)
+
+	items := testItems("merge", 2)
+	if _, err := ingestItems(ctx, conn, db, fromID, items, RetentionPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ingestItems(ctx, conn, db, toID, items[1:], RetentionPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+
+	const threshold = 2
+	for i := 1; i < threshold; i++ {
+		merged, err := followRedirect(ctx, conn, db, from, to.Url, threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if merged {
+			t.Fatalf("merged after %d redirects, want %d", i, threshold)
+		}
+	}
+	merged, err := followRedirect(ctx, conn, db, from, to.Url, threshold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !merged {
+		t.Fatalf("not merged after %d redirects", threshold)
+	}
+
+	if _, err := db.GetFeedByID(ctx, fromID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("merged feed: err = %v, want sql.ErrNoRows", err)
+	}
+
+	count := func(query string, args ...any) int {
+		t.Helper()
+		var n int
+		if err := conn.QueryRow(query, args...).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count("SELECT count(*) FROM posts WHERE feed_id = $1", toID); n != 2 {
+		t.Errorf("%d posts in the target feed, want 2", n)
+	}
+	for _, userID := range []uuid.UUID{onlyFrom, both} {
+		if n := count("SELECT count(*) FROM feed_follows WHERE user_id = $1 AND feed_id = $2", userID, toID); n != 1 {
+			t.Errorf("user %s follows the target %d times, want 1", userID, n)
+		}
+	}
+}
+
+// Below the threshold nothing moves, and a feed that stops redirecting starts
+// counting from scratch.
+func TestFollowRedirectThreshold(t *testing.T) {
+	conn := openTestDB(t)
+	db := database.New(conn)
+	ctx := context.Background()
+
+	feedID := createTestFeed(t, conn)
+	getFeed := func() database.Feed {
+		t.Helper()
+		feed, err := db.GetFeedByID(ctx, feedID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return feed
+	}
+	redirectURL := "https://example.com/" + uuid.NewString() + ".xml"
+	redirect := func(url string) {
+		t.Helper()
+		if merged, err := followRedirect(ctx, conn, db, getFeed(), url, 3); err != nil || merged {
+			t.Fatalf("followRedirect = %v, %v; want no merge", merged, err)
+		}
+	}
+
+	redirect(redirectURL)
+	redirect(redirectURL)
+	redirect("") // the publisher changed their mind
+	if feed := getFeed(); feed.RedirectCount != 0 {
+		t.Errorf("redirect count = %d after the redirect went away, want 0", feed.RedirectCount)
+	}
+
+	redirect(redirectURL)
+	redirect(redirectURL)
+	if feed := getFeed(); feed.Url == redirectURL {
+		t.Error("moved before reaching the threshold")
+	}
+	redirect(redirectURL)
+	if feed := getFeed(); feed.Url != redirectURL {
+		t.Errorf("url = %s after 3 redirects, want %s", feed.Url, redirectURL)
+	}
+}
@@ -0,0 +1,156 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	// another instance holds the feed's lease, or it's not scraped anymore
+	ErrFeedBusy         = errors.New("feed can't be scraped right now")
+	ErrRefreshQueueFull = errors.New("too many refreshes queued")
+)
+
+// refreshes waiting for a free worker, past that Refresh fails
+const refreshQueueSize = 100
+
+// scrapeJob is one scrape of a feed that callers can wait on.
+type scrapeJob struct {
+	id      uuid.UUID // also the ID of its feed_fetches row
+	feedID  uuid.UUID
+	started bool          // a worker took it, guarded by refresher.mu
+	done    chan struct{} // closed once it ran (or couldn't)
+	err     error         // why it couldn't run, set before done is closed
+}
+
+func newScrapeJob(feedID uuid.UUID) *scrapeJob {
+	return &scrapeJob{id: uuid.New(), feedID: feedID, done: make(chan struct{})}
+}
+
+// refresher queues on-demand scrapes for the worker pool, workers take them
+// before due feeds. A feed is never scraped twice at once by this instance:
+// refreshing a feed already queued or being scraped joins that job.
+type refresher struct {
+	jobs chan *scrapeJob
+
+	mu      sync.Mutex
+	running map[uuid.UUID]*scrapeJob // by feed ID, refreshes and due scrapes alike
+}
+
+func newRefresher() *refresher {
+	return &refresher{
+		jobs:    make(chan *scrapeJob, refreshQueueSize),
+		running: map[uuid.UUID]*scrapeJob{},
+	}
+}
+
+// refresh is Scraper.Refresh.
+func (r *refresher) refresh(ctx context.Context, feedID uuid.UUID, wait time.Duration) (jobID uuid.UUID, done bool, err error) {
+	r.mu.Lock()
+	job, ok := r.running[feedID]
+	if !ok {
+		job = newScrapeJob(feedID)
+		select {
+		case r.jobs <- job:
+			r.running[feedID] = job
+			queueDepth.Set(float64(len(r.jobs)), "refresh")
+		default:
+			r.mu.Unlock()
+			return uuid.Nil, false, ErrRefreshQueueFull
+		}
+	}
+	r.mu.Unlock()
+
+	if wait <= 0 {
+		return job.id, false, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-job.done:
+		return job.id, true, job.err
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return job.id, false, nil
+}
+
+// startDue tracks the scrape of a feed the ticker claimed. A refresh of it
+// still queued is taken over, its callers get this run.
+func (r *refresher) startDue(feedID uuid.UUID) *scrapeJob {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, ok := r.running[feedID]
+	if ok && !job.started {
+		job.started = true
+		return job
+	}
+	job = newScrapeJob(feedID)
+	job.started = true
+	if !ok {
+		r.running[feedID] = job
+	}
+	return job
+}
+
+// start takes a queued refresh, false when a due scrape of the feed already
+// took it over.
+func (r *refresher) start(job *scrapeJob) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if job.started {
+		return false
+	}
+	job.started = true
+	return true
+}
+
+func (r *refresher) finish(job *scrapeJob, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.running[job.feedID] == job {
+		delete(r.running, job.feedID)
+	}
+	job.err = err
+	close(job.done)
+}
+
+// runRefresh scrapes the feed of a refresh job whether it's due or not. It
+// leases the feed first, like due feeds, so other instances leave it alone.
+func (s *Scraper) runRefresh(ctx context.Context, job *scrapeJob) {
+	queueDepth.Set(float64(len(s.refresher.jobs)), "refresh")
+	if !s.refresher.start(job) {
+		return
+	}
+
+	feed, err := s.db.ClaimFeedForRefresh(ctx, database.ClaimFeedForRefreshParams{
+		LeaseOwner:   s.leaseOwner,
+		LeaseSeconds: int64(feedLeaseDuration.Seconds()),
+		ID:           job.feedID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		s.refresher.finish(job, ErrFeedBusy)
+		return
+	}
+	if err != nil {
+		log.Printf("Error claiming feed %s for refresh: %v", job.feedID, err)
+		s.refresher.finish(job, fmt.Errorf("claim feed %s: %w", job.feedID, err))
+		return
+	}
+
+	s.scrape(ctx, feed, job.id)
+	s.refresher.finish(job, nil)
+}
@@ -0,0 +1,137 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/google/uuid"
+)
+
+// Posts deleted per statement, and the pause between two statements so the
+// scraper and readers get their turn on the table.
+const (
+	pruneBatchSize  = 1000
+	pruneBatchPause = 100 * time.Millisecond
+)
+
+// RetentionPolicy is the global post retention, feeds can override KeepDays
+// and KeepPosts (feed_retention_policies). 0 means no limit.
+type RetentionPolicy struct {
+	KeepDays  int // posts published longer ago than that go
+	KeepPosts int // only the latest posts of each feed stay
+	// posts published or stored more recently are always kept
+	Floor time.Duration
+}
+
+// Pruner deletes the posts the retention policies don't keep. Posts can't be
+// starred or annotated yet, when they can CountPrunablePosts and
+// DeletePrunablePosts must leave those alone.
+type Pruner struct {
+	db     *database.Queries
+	policy RetentionPolicy
+}
+
+func NewPruner(conn *sql.DB, policy RetentionPolicy) *Pruner {
+	return &Pruner{db: database.New(conn), policy: policy}
+}
+
+func (p *Pruner) Policy() RetentionPolicy {
+	return p.policy
+}
+
+// DryRun counts what Prune would delete right now, per feed, most first.
+func (p *Pruner) DryRun(ctx context.Context) ([]database.CountPrunablePostsRow, error) {
+	counts, err := p.db.CountPrunablePosts(ctx, database.CountPrunablePostsParams{
+		FloorSeconds: int64(p.policy.Floor.Seconds()),
+		KeepDays:     int32(p.policy.KeepDays),
+		KeepPosts:    int32(p.policy.KeepPosts),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("count prunable posts: %w", err)
+	}
+	return counts, nil
+}
+
+// Prune deletes expired posts feed by feed, in batches, their enclosures,
+// categories and revisions with them. It's a scheduler Job.
+func (p *Pruner) Prune(ctx context.Context) error {
+	counts, err := p.DryRun(ctx)
+	if err != nil {
+		return err
+	}
+
+	var deleted int64
+	for _, count := range counts {
+		for {
+			rows, err := p.db.DeletePrunablePosts(ctx, database.DeletePrunablePostsParams{
+				FeedID:       count.FeedID,
+				FloorSeconds: int64(p.policy.Floor.Seconds()),
+				KeepDays:     int32(p.policy.KeepDays),
+				KeepPosts:    int32(p.policy.KeepPosts),
+				BatchSize:    pruneBatchSize,
+			})
+			if err != nil {
+				return fmt.Errorf("prune posts of feed %s (%d deleted so far): %w", count.FeedID, deleted, err)
+			}
+			deleted += rows
+			postsPruned.Add(float64(rows))
+			if rows < pruneBatchSize {
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("prune posts (%d deleted so far): %w", deleted, ctx.Err())
+			case <-time.After(pruneBatchPause):
+			}
+		}
+	}
+
+	log.Printf("Pruned %d posts of %d feeds", deleted, len(counts))
+	return nil
+}
+
+// retentionCutoff is when items of the feed must have been published for
+// ingestion to store them, zero when the policy keeps everything. Older ones
+// would go with the next Prune once past the Floor, then come back with the
+// next scrape while the feed still lists them, over and over.
+func retentionCutoff(ctx context.Context, db *database.Queries, feedID uuid.UUID, policy RetentionPolicy) (time.Time, error) {
+	retention, err := db.GetFeedRetention(ctx, database.GetFeedRetentionParams{
+		KeepDays:  int32(policy.KeepDays),
+		KeepPosts: int32(policy.KeepPosts),
+		FeedID:    feedID,
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("get retention of feed %s: %w", feedID, err)
+	}
+
+	now := time.Now().UTC()
+	var cutoff time.Time
+	if retention.KeepDays > 0 {
+		cutoff = now.AddDate(0, 0, -int(retention.KeepDays))
+	}
+	if retention.KeepPosts > 0 {
+		// older than the last post kept, once the feed has that many
+		publishedAt, err := db.GetNthLatestPostPublishedAt(ctx, database.GetNthLatestPostPublishedAtParams{
+			FeedID: feedID,
+			Offset: retention.KeepPosts - 1,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, fmt.Errorf("get latest posts of feed %s: %w", feedID, err)
+		}
+		if err == nil && publishedAt.After(cutoff) {
+			cutoff = publishedAt
+		}
+	}
+
+	// the floor keeps whatever was published since, whatever the policy
+	if floor := now.Add(-policy.Floor); cutoff.After(floor) {
+		cutoff = floor
+	}
+	return cutoff, nil
+}
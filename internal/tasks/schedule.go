@@ -0,0 +1,94 @@
+package tasks
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+)
+
+const (
+	minFetchInterval     = 10 * time.Minute
+	maxFetchInterval     = 24 * time.Hour
+	defaultFetchInterval = time.Hour // when we can't tell how often the feed publishes
+
+	// how many of the newest posts we look at to guess the publishing rate
+	publishRateSample = 10
+)
+
+/*
+nextFetchInterval works out how long to wait before fetching the feed again.
+
+ 1. Publishing rate: average gap between the newest posts, counting the silence
+    since the last one (now → newest → ... → oldest of the sample). We poll
+    twice per expected post so we're never a full gap late.
+ 2. Publisher hints: never sooner than <ttl>, sy:updatePeriod or
+    Cache-Control/Expires ask for.
+ 3. Everything is clamped to [minFetchInterval, maxFetchInterval].
+
+e.g. a wire service with 10 posts in the last hour → 3 min → clamped to 10 min,
+a blog with 10 posts in the last year → 18 days → clamped to 24h.
+*/
+func nextFetchInterval(now time.Time, publishedAt []time.Time, hints ...time.Duration) time.Duration {
+	interval := defaultFetchInterval
+
+	newest := sortedNewestFirst(publishedAt, now)
+	if n := min(len(newest), publishRateSample); n > 0 {
+		averageGap := now.Sub(newest[n-1]) / time.Duration(n)
+		interval = averageGap / 2
+	}
+
+	return withHints(interval, hints...)
+}
+
+// unchangedFetchInterval is used when the fetch tells us nothing new (304): we
+// keep the pace of the last full fetch (fetch_interval_seconds), still
+// honoring the hints. Not the gap between the last fetch and this one, it
+// includes any failure backoff or Retry-After wait.
+func unchangedFetchInterval(feed database.Feed, hints ...time.Duration) time.Duration {
+	interval := defaultFetchInterval
+	if feed.FetchIntervalSeconds.Valid {
+		interval = time.Duration(feed.FetchIntervalSeconds.Int32) * time.Second
+	}
+	return withHints(interval, hints...)
+}
+
+func withHints(interval time.Duration, hints ...time.Duration) time.Duration {
+	for _, hint := range hints {
+		interval = max(interval, hint)
+	}
+	return min(max(interval, minFetchInterval), maxFetchInterval)
+}
+
+// dates in the future (bad clocks, scheduled posts) count as now
+func sortedNewestFirst(dates []time.Time, now time.Time) []time.Time {
+	sorted := make([]time.Time, len(dates))
+	for i, date := range dates {
+		if date.After(now) {
+			date = now
+		}
+		sorted[i] = date
+	}
+	slices.SortFunc(sorted, func(a, b time.Time) int {
+		return b.Compare(a)
+	})
+	return sorted
+}
+
+// failureBackoff doubles the wait with every consecutive failure, starting at
+// minFetchInterval and capped at maxFetchInterval:
+//
+//	1 → 10m, 2 → 20m, 3 → 40m, 4 → 80m, ... → 24h
+//
+// The result is randomized between half and the full value so feeds that broke
+// together (same host down) don't keep retrying together.
+func failureBackoff(failures int) time.Duration {
+	backoff := minFetchInterval
+	for i := 1; i < failures && backoff < maxFetchInterval; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, maxFetchInterval)
+
+	return backoff/2 + rand.N(backoff/2+1)
+}
@@ -0,0 +1,100 @@
+package tasks
+
+import (
+	"database/sql"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+)
+
+func TestUnchangedFetchInterval(t *testing.T) {
+	lastFetched := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	pace := func(d time.Duration) sql.NullInt32 {
+		return sql.NullInt32{Int32: int32(d.Seconds()), Valid: true}
+	}
+
+	tests := []struct {
+		name  string
+		feed  database.Feed
+		hints []time.Duration
+		want  time.Duration
+	}{
+		{
+			// a 304 right after recovering from failures: the backoff must not
+			// become the feed's pace
+			name: "after a failure backoff",
+			feed: database.Feed{
+				LastFetchedAt:        sql.NullTime{Time: lastFetched, Valid: true},
+				NextFetchAt:          lastFetched.Add(16 * time.Hour),
+				FetchIntervalSeconds: pace(30 * time.Minute),
+			},
+			want: 30 * time.Minute,
+		},
+		{
+			name: "after a Retry-After wait",
+			feed: database.Feed{
+				LastFetchedAt:        sql.NullTime{Time: lastFetched, Valid: true},
+				NextFetchAt:          lastFetched.Add(6 * time.Hour),
+				FetchIntervalSeconds: pace(2 * time.Hour),
+			},
+			want: 2 * time.Hour,
+		},
+		{
+			name:  "with a longer Cache-Control",
+			feed:  database.Feed{FetchIntervalSeconds: pace(30 * time.Minute)},
+			hints: []time.Duration{3 * time.Hour},
+			want:  3 * time.Hour,
+		},
+		{
+			name: "never fully fetched",
+			feed: database.Feed{
+				LastFetchedAt: sql.NullTime{Time: lastFetched, Valid: true},
+				NextFetchAt:   lastFetched.Add(12 * time.Hour),
+			},
+			want: defaultFetchInterval,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unchangedFetchInterval(tt.feed, tt.hints...); got != tt.want {
+				t.Errorf("unchangedFetchInterval = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration // before jitter, the result is in [want/2, want]
+	}{
+		{0, 10 * time.Minute},
+		{1, 10 * time.Minute},
+		{2, 20 * time.Minute},
+		{3, 40 * time.Minute},
+		{4, 80 * time.Minute},
+		{8, 1280 * time.Minute},
+		{9, maxFetchInterval},
+		{1000, maxFetchInterval},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.failures), func(t *testing.T) {
+			lowest, highest := tt.want, time.Duration(0)
+			for range 1000 {
+				got := failureBackoff(tt.failures)
+				if got < tt.want/2 || got > tt.want {
+					t.Fatalf("failureBackoff(%d) = %s, want between %s and %s", tt.failures, got, tt.want/2, tt.want)
+				}
+				lowest, highest = min(lowest, got), max(highest, got)
+			}
+			// jittered: feeds that broke together must not retry together
+			if highest-lowest < tt.want/4 {
+				t.Errorf("failureBackoff(%d) spans %s to %s only, want it spread over [%s, %s]", tt.failures, lowest, highest, tt.want/2, tt.want)
+			}
+		})
+	}
+}
@@ -3,116 +3,547 @@ package tasks
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alepaez-dev/rss_aggregator/internal/database"
-	"github.com/alepaez-dev/rss_aggregator/internal/dberr"
 	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
 	"github.com/google/uuid"
 )
 
-func scrapeFeed(ctx context.Context, db *database.Queries, feed database.Feed) error {
-	_, err := db.MarkFeedAsFetched(ctx, feed.ID)
+// empty string → NULL
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// Options tune the scraper, main reads them from the environment.
+type Options struct {
+	Concurrency int
+	Interval    time.Duration // how often due feeds are claimed
+	// failures in a row before a feed gets disabled
+	MaxFailures int
+	// permanent redirects in a row before a feed URL is rewritten
+	RedirectThreshold int
+	// public base URL of the API, WebSub hubs call it back. "" disables WebSub.
+	WebSubCallbackURL string
+	// the global post retention, items it would prune right away aren't stored
+	Retention RetentionPolicy
+}
+
+// Limits of what can be changed at runtime (SetPace).
+const (
+	maxConcurrency = 100
+	minInterval    = time.Second
+	maxInterval    = time.Hour
+)
+
+var (
+	ErrScraperPaused  = errors.New("scraper is paused")
+	ErrInvalidSetting = errors.New("invalid scraper setting")
+)
+
+// Scraper fetches due feeds with a pool of workers. It lives as long as the
+// process: Run drives it until its context is cancelled, and it can be paused,
+// resized and re-paced meanwhile (admin API) without dropping in-flight jobs.
+type Scraper struct {
+	conn       *sql.DB
+	db         *database.Queries
+	limiter    *hostLimiter
+	refresher  *refresher
+	instanceID string
+	leaseOwner sql.NullString // instanceID, as lease owner of the feeds we claim
+	jobs       chan database.Feed
+	busy       atomic.Int32 // workers scraping a feed right now
+
+	mu          sync.Mutex
+	opts        Options // Concurrency and Interval change at runtime
+	paused      bool
+	running     bool
+	runCtx      context.Context // Run's, for workers started later
+	ticker      *time.Ticker
+	workerQuits []chan struct{} // one per worker, closed to stop it after its current job
+	wg          sync.WaitGroup
+}
+
+// ScraperStatus is a snapshot of the scraper, for the admin API.
+type ScraperStatus struct {
+	InstanceID      string
+	Running         bool
+	Paused          bool
+	Concurrency     int
+	BusyWorkers     int
+	Interval        time.Duration
+	QueuedRefreshes int
+}
+
+func NewScraper(conn *sql.DB, opts Options) *Scraper {
+	instanceID := newInstanceID()
+	return &Scraper{
+		conn:       conn,
+		db:         database.New(conn),
+		limiter:    newHostLimiter(maxHostConnections, minHostDelay),
+		refresher:  newRefresher(),
+		instanceID: instanceID,
+		leaseOwner: sql.NullString{String: instanceID, Valid: true},
+		jobs:       make(chan database.Feed),
+		opts:       opts,
+	}
+}
+
+// Pause stops claiming due feeds and refuses refreshes, jobs already handed
+// to a worker finish. Like every setting below it's shared by all instances
+// (scraper_settings): this one applies it now, the others on their next tick.
+func (s *Scraper) Pause(ctx context.Context) error {
+	if err := s.db.SetScraperPaused(ctx, true); err != nil {
+		return fmt.Errorf("pause scraper: %w", err)
+	}
+	return s.syncSettings(ctx)
+}
+
+func (s *Scraper) Resume(ctx context.Context) error {
+	if err := s.db.SetScraperPaused(ctx, false); err != nil {
+		return fmt.Errorf("resume scraper: %w", err)
+	}
+	return s.syncSettings(ctx)
+}
+
+// SetPace resizes the worker pool and changes how often due feeds are
+// claimed, on every instance; nil keeps the current value. Both are checked
+// before either is saved. Extra workers stop once done with their current
+// feed, the new interval applies from the next tick.
+func (s *Scraper) SetPace(ctx context.Context, concurrency *int, interval *time.Duration) error {
+	arg := database.SetScraperPaceParams{}
+	if concurrency != nil {
+		if *concurrency < 1 || *concurrency > maxConcurrency {
+			return fmt.Errorf("%w: concurrency must be between 1 and %d", ErrInvalidSetting, maxConcurrency)
+		}
+		arg.Concurrency = sql.NullInt32{Int32: int32(*concurrency), Valid: true}
+	}
+	if interval != nil {
+		if *interval < minInterval || *interval > maxInterval {
+			return fmt.Errorf("%w: interval must be between %s and %s", ErrInvalidSetting, minInterval, maxInterval)
+		}
+		arg.IntervalSeconds = sql.NullInt32{Int32: int32(interval.Seconds()), Valid: true}
+	}
+
+	if err := s.db.SetScraperPace(ctx, arg); err != nil {
+		return fmt.Errorf("set scraper pace: %w", err)
+	}
+	return s.syncSettings(ctx)
+}
+
+// syncSettings applies the shared settings, whichever instance admins changed
+// them on. Settings never set keep what the instance started with.
+func (s *Scraper) syncSettings(ctx context.Context) error {
+	settings, err := s.db.GetScraperSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("get scraper settings: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if settings.Paused != s.paused {
+		s.paused = settings.Paused
+		if s.paused {
+			log.Printf("Scraper %s paused", s.instanceID)
+		} else {
+			log.Printf("Scraper %s resumed", s.instanceID)
+		}
+	}
+	if concurrency := int(settings.Concurrency.Int32); settings.Concurrency.Valid && concurrency != s.opts.Concurrency {
+		s.opts.Concurrency = concurrency
+		if s.running {
+			s.resizePool()
+		}
+		log.Printf("Scraper %s concurrency set to %d", s.instanceID, concurrency)
+	}
+	if interval := time.Duration(settings.IntervalSeconds.Int32) * time.Second; settings.IntervalSeconds.Valid && interval != s.opts.Interval {
+		s.opts.Interval = interval
+		if s.ticker != nil {
+			s.ticker.Reset(interval)
+		}
+		log.Printf("Scraper %s interval set to %s", s.instanceID, interval)
+	}
+	return nil
+}
+
+func (s *Scraper) Status() ScraperStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return ScraperStatus{
+		InstanceID:      s.instanceID,
+		Running:         s.running,
+		Paused:          s.paused,
+		Concurrency:     s.opts.Concurrency,
+		BusyWorkers:     int(s.busy.Load()),
+		Interval:        s.opts.Interval,
+		QueuedRefreshes: len(s.refresher.jobs),
+	}
+}
+
+// Refresh queues a scrape of the feed and waits up to wait for it, 0 to not
+// wait. jobID is also the ID of the run in feed_fetches, done is false while
+// it's queued or running.
+func (s *Scraper) Refresh(ctx context.Context, feedID uuid.UUID, wait time.Duration) (jobID uuid.UUID, done bool, err error) {
+	s.mu.Lock()
+	paused := s.paused
+	s.mu.Unlock()
+
+	if paused {
+		return uuid.Nil, false, ErrScraperPaused
+	}
+	return s.refresher.refresh(ctx, feedID, wait)
+}
+
+// resizePool starts or stops workers to match opts.Concurrency, s.mu held.
+func (s *Scraper) resizePool() {
+	for len(s.workerQuits) < s.opts.Concurrency {
+		quit := make(chan struct{})
+		s.workerQuits = append(s.workerQuits, quit)
+		s.wg.Add(1)
+		go s.worker(s.runCtx, quit)
+	}
+	for len(s.workerQuits) > s.opts.Concurrency {
+		last := len(s.workerQuits) - 1
+		close(s.workerQuits[last])
+		s.workerQuits = s.workerQuits[:last]
+	}
+	workers.Set(float64(s.opts.Concurrency))
+}
+
+func (s *Scraper) scrapeFeed(ctx context.Context, feed database.Feed, run *fetchRun) error {
+	// if anything below fails the feed is retried after minFetchInterval
+	_, err := s.db.MarkFeedAsFetched(ctx, database.MarkFeedAsFetchedParams{
+		ID:                 feed.ID,
+		NextFetchInSeconds: int64(minFetchInterval.Seconds()),
+	})
 	if err != nil {
 		return fmt.Errorf("mark feed as fetched: %w", err)
 	}
 
-	rssFeed, err := feeds.UrlToFeed(ctx, feed.Url)
+	host := hostOf(feed.Url)
+	release, err := s.limiter.acquire(ctx, host)
 	if err != nil {
-		return fmt.Errorf("fetch feed URL %s: %w", feed.Url, err)
+		return fmt.Errorf("wait for host %s: %w", host, err)
 	}
 
-	for _, item := range rssFeed.Channel.Item {
-		publishedAt, err := time.Parse(time.RFC1123Z, item.PubDate)
-		if err != nil {
-			publishedAt, err = time.Parse(time.RFC1123, item.PubDate)
-			if err != nil {
-				return fmt.Errorf("parse pubDate %q for feed %s: %w", item.PubDate, feed.ID, err)
-			}
+	result, err := feeds.UrlToFeed(ctx, feed.Url, feeds.Validators{
+		ETag:         feed.Etag.String,
+		LastModified: feed.LastModified.String,
+	})
+	release()
+	run.statusCode = result.StatusCode
+	run.bytes = result.BodySize
+	run.itemsSeen = len(result.Feed.Items)
+	if errors.Is(err, feeds.ErrRateLimited) {
+		// the whole host is throttled, not only this feed
+		retryAfter := result.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = defaultRetryAfter
 		}
-
-		_, err = db.CreatePost(ctx, database.CreatePostParams{
-			ID:          uuid.New(),
-			Title:       item.Title,
-			Description: sql.NullString{String: item.Description, Valid: item.Description != ""},
-			PublishedAt: publishedAt,
-			Url:         item.Link,
-			FeedID:      feed.ID,
-		})
+		until := s.limiter.backOff(host, min(retryAfter, maxFetchInterval))
+		return &throttledError{host: host, until: until, cause: err}
+	}
+	if err == nil || errors.Is(err, feeds.ErrNotModified) {
+		merged, err := followRedirect(ctx, s.conn, s.db, feed, result.PermanentRedirect, s.opts.RedirectThreshold)
 		if err != nil {
-			if dberr.IsUniqueViolation(err) {
-				fmt.Println("Post already exists, skipping")
-				continue
-			}
-			return fmt.Errorf("create post for feed %s: %w", feed.ID, err)
+			return err
+		}
+		if merged {
+			run.merged = true
+			return nil // the feed we merged into is scraped on its own
+		}
+	}
+	if errors.Is(err, feeds.ErrNotModified) {
+		// 304, nothing new since last time so we keep the same pace
+		pace := unchangedFetchInterval(feed)
+		interval := withHints(pace, result.MaxAge)
+		if pushInterval, ok := s.syncWebSub(ctx, feed.ID, "", ""); ok {
+			interval = pushInterval
 		}
+		return scheduleNextFetch(ctx, s.db, feed, interval, pace)
+	}
+	if err != nil {
+		return fmt.Errorf("fetch feed URL %s: %w", feed.Url, err)
+	}
+
+	run.stats, err = ingestItems(ctx, s.conn, s.db, feed.ID, result.Feed.Items, s.opts.Retention)
+	if err != nil {
+		return err
+	}
+
+	// only saved once every post is in, otherwise a failed run would be followed
+	// by a 304 and we'd never see the missing items
+	err = s.db.UpdateFeedCacheValidators(ctx, database.UpdateFeedCacheValidatorsParams{
+		ID:           feed.ID,
+		Etag:         nullString(result.Validators.ETag),
+		LastModified: nullString(result.Validators.LastModified),
+	})
+	if err != nil {
+		return fmt.Errorf("update cache validators for feed %s: %w", feed.ID, err)
 	}
 
+	// the document's hints are part of the pace, Cache-Control comes with
+	// every response
+	pace := nextFetchInterval(time.Now(), run.stats.publishedDates, result.Feed.UpdateInterval)
+	interval := withHints(pace, result.MaxAge)
+	if pushInterval, ok := s.syncWebSub(ctx, feed.ID, result.Feed.Hub, websubTopic(result.Feed, feed.Url)); ok {
+		// the hub pushes new posts, polling is only a safety net
+		interval = pushInterval
+	}
+	return scheduleNextFetch(ctx, s.db, feed, interval, pace)
+}
+
+// scheduleNextFetch fetches the feed again in interval, pace is what the 304s
+// that follow go by (unchangedFetchInterval).
+func scheduleNextFetch(ctx context.Context, db *database.Queries, feed database.Feed, interval, pace time.Duration) error {
+	err := db.RecordFeedSuccess(ctx, database.RecordFeedSuccessParams{
+		NextFetchInSeconds:   int64(interval.Seconds()),
+		FetchIntervalSeconds: int32(pace.Seconds()),
+		ID:                   feed.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("schedule next fetch for feed %s: %w", feed.ID, err)
+	}
 	return nil
 }
 
-func worker(
-	ctx context.Context,
-	jobs <-chan database.Feed,
-	wg *sync.WaitGroup,
-	db *database.Queries,
-) {
-	defer wg.Done() // worker finished
+// isPermanent tells failures retrying won't fix (the URL is not allowed) from
+// temporary ones like timeouts or 5xx. Gone feeds don't get here, see markDead.
+func isPermanent(err error) bool {
+	return errors.Is(err, feeds.ErrBlockedURL)
+}
+
+// markDead stops scraping a feed that answered 410 Gone, followers see its
+// status change.
+func markDead(ctx context.Context, db *database.Queries, feed database.Feed, scrapeErr error) {
+	err := db.MarkFeedDead(ctx, database.MarkFeedDeadParams{
+		LastError: nullString(scrapeErr.Error()),
+		ID:        feed.ID,
+	})
+	if err != nil {
+		log.Printf("Error marking feed %s as dead: %v", feed.ID, err)
+		return
+	}
+	log.Printf("Feed %s is gone, marked as dead", feed.ID)
+}
+
+// recordFailure pushes the feed back with exponential backoff and disables it
+// after maxFailures failures in a row.
+func recordFailure(ctx context.Context, db *database.Queries, feed database.Feed, scrapeErr error, maxFailures int) {
+	failures := int(feed.ConsecutiveFailures) + 1
+
+	retryIn := failureBackoff(failures)
+	if isPermanent(scrapeErr) {
+		retryIn = maxFetchInterval // no point trying again soon
+	}
+
+	updated, err := db.RecordFeedFailure(ctx, database.RecordFeedFailureParams{
+		LastError:      nullString(scrapeErr.Error()),
+		RetryInSeconds: int64(retryIn.Seconds()),
+		MaxFailures:    int32(maxFailures),
+		ID:             feed.ID,
+	})
+	if err != nil {
+		log.Printf("Error recording failure of feed %s: %v", feed.ID, err)
+		return
+	}
+
+	if updated.DisabledAt.Valid {
+		log.Printf("Feed %s disabled after %d consecutive failures", feed.ID, updated.ConsecutiveFailures)
+	}
+}
+
+// recordThrottled reschedules the feed for when its host lets us back in,
+// without counting it as a failure.
+func recordThrottled(ctx context.Context, db *database.Queries, feed database.Feed, until time.Time) {
+	err := db.RecordFeedThrottled(ctx, database.RecordFeedThrottledParams{
+		RetryInSeconds: int64(math.Ceil(time.Until(until).Seconds())),
+		ID:             feed.ID,
+	})
+	if err != nil {
+		log.Printf("Error recording throttling of feed %s: %v", feed.ID, err)
+	}
+}
+
+// scrape runs scrapeFeed on a feed we hold the lease of and records how it
+// went, fetchID is the ID of its feed_fetches row.
+func (s *Scraper) scrape(ctx context.Context, feed database.Feed, fetchID uuid.UUID) {
+	feedCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel() // free resources, scrapeFeed is sync this means it's done
+
+	s.busy.Add(1)
+	busyWorkers.Add(1)
+	defer func() {
+		s.busy.Add(-1)
+		busyWorkers.Add(-1)
+	}()
+
+	var throttled *throttledError
+	var run fetchRun
+	start := time.Now()
+	err := s.scrapeFeed(feedCtx, feed, &run)
+	duration := time.Since(start)
+
+	fetchesTotal.Inc(fetchOutcome(run, err, ctx.Err() != nil))
+	fetchDuration.Observe(duration.Seconds())
+	downloadedBytes.Add(float64(run.bytes))
+
+	if ctx.Err() == nil && !run.merged {
+		recordFetch(ctx, s.db, fetchID, feed.ID, run, duration, err)
+	}
+	switch {
+	case err == nil:
+	case ctx.Err() != nil:
+		// shutting down is not the feed's fault
+		log.Printf("Error scraping feed %s: %v", feed.ID, err)
+	case errors.As(err, &throttled):
+		log.Printf("Feed %s postponed: %v", feed.ID, err)
+		recordThrottled(ctx, s.db, feed, throttled.until)
+	case errors.Is(err, feeds.ErrGone):
+		markDead(ctx, s.db, feed, err)
+	default:
+		log.Printf("Error scraping feed %s: %v", feed.ID, err)
+		// feedCtx may have timed out, so the root ctx records it
+		recordFailure(ctx, s.db, feed, err, s.opts.MaxFailures)
+	}
+}
+
+func (s *Scraper) worker(ctx context.Context, quit <-chan struct{}) {
+	defer s.wg.Done() // worker finished
 	for {
+		// stopped by SetPace, refreshes go before due feeds
+		select {
+		case <-quit:
+			return
+		case job := <-s.refresher.jobs:
+			s.runRefresh(ctx, job)
+			continue
+		default:
+		}
+
 		select {
 		case <-ctx.Done():
 			return
-		case feed, ok := <-jobs: // we received a feed 🙏
+		case <-quit:
+			return
+		case job := <-s.refresher.jobs:
+			s.runRefresh(ctx, job)
+		case feed, ok := <-s.jobs: // we received a feed 🙏
 			if !ok { // safe check → is channel closed?
 				return
 			}
-			feedCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
-			if err := scrapeFeed(feedCtx, db, feed); err != nil {
-				log.Printf("Error scraping feed %s: %v", feed.ID, err)
-			}
-			cancel() // free resources, scrapFeed is sync this means it's done
+			job := s.refresher.startDue(feed.ID)
+			s.scrape(ctx, feed, job.id)
+			s.refresher.finish(job, nil)
 		}
 	}
 }
 
-func StartScraping(ctx context.Context, db *database.Queries, concurrency int, interval time.Duration) {
-	ticker := time.NewTicker(interval)
+// How long a claimed feed stays ours. Must be well above the per-feed timeout
+// plus the time a claimed feed can wait for a free worker, otherwise another
+// instance could claim it while we're still on it.
+const feedLeaseDuration = 5 * time.Minute
 
-	// cleanup (2nd)
-	defer ticker.Stop()
+// newInstanceID names this scraper as lease owner, readable enough to tell
+// replicas apart when looking at the feeds table.
+func newInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8])
+}
 
-	jobs := make(chan database.Feed)
+// Run runs the worker pool until ctx is cancelled, call it once. Feeds failing
+// MaxFailures times in a row get disabled. Requests are spread per host
+// (hostLimiter) and a 429, or a 503 with Retry-After, postpones every feed of
+// that host. Feeds permanently redirected RedirectThreshold times in a row
+// follow the redirect. Feeds with a WebSub hub get subscribed and are polled
+// rarely. Refreshes are scraped before due feeds.
+//
+// Several instances can run against the same database: feeds are leased
+// (ClaimFeedsToFetch) so each one is only scraped by one instance at a time,
+// and admin settings are shared (syncSettings).
+func (s *Scraper) Run(ctx context.Context) {
+	// an instance starting while scraping is paused must not resume it
+	if err := s.syncSettings(ctx); err != nil {
+		log.Printf("Error syncing scraper %s settings: %v", s.instanceID, err)
+	}
 
-	var wg sync.WaitGroup
-	wg.Add(concurrency) // we will wait for N workers to finish
+	s.mu.Lock()
+	s.running = true
+	s.runCtx = ctx
+	s.ticker = time.NewTicker(s.opts.Interval)
+	s.resizePool()
+	s.mu.Unlock()
 
-	for i := 0; i < concurrency; i++ {
-		go worker(ctx, jobs, &wg, db)
-	}
+	// cleanup (3rd) → hand back feeds we claimed but didn't get to, no need to
+	// wait for the leases to expire. ctx is cancelled by now so we need a new one.
+	defer func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.db.ReleaseFeedLeases(releaseCtx, s.leaseOwner); err != nil {
+			log.Printf("Error releasing feed leases of %s: %v", s.instanceID, err)
+		}
+	}()
+
+	// cleanup (2nd)
+	defer s.ticker.Stop()
 
 	// cleanup (1st)
 	defer func() {
-		close(jobs) // current jobs keep going but no future jobs
-		wg.Wait()   // WAIT for all workers to finish
+		s.mu.Lock()
+		s.running = false // no more workers from SetPace
+		s.workerQuits = nil
+		s.mu.Unlock()
+
+		close(s.jobs) // current jobs keep going but no future jobs
+		s.wg.Wait()   // WAIT for all workers to finish
 	}()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			feeds, err := db.GetNextFeedsToFetch(ctx, int32(concurrency))
+		case <-s.ticker.C:
+			// picks up what admins changed on other instances
+			if err := s.syncSettings(ctx); err != nil {
+				log.Printf("Error syncing scraper %s settings: %v", s.instanceID, err)
+			}
+
+			s.mu.Lock()
+			paused, maxFeeds := s.paused, s.opts.Concurrency
+			s.mu.Unlock()
+			if paused {
+				continue
+			}
+
+			feeds, err := s.db.ClaimFeedsToFetch(ctx, database.ClaimFeedsToFetchParams{
+				LeaseOwner:   s.leaseOwner,
+				LeaseSeconds: int64(feedLeaseDuration.Seconds()),
+				MaxFeeds:     int32(maxFeeds),
+			})
 			if err != nil {
+				log.Printf("Error claiming feeds: %v", err)
 				continue
 			}
+			// claimed feeds are ours, they're handed out even if we get paused meanwhile
+			queueDepth.Set(float64(len(feeds)), "due")
 			for _, f := range feeds {
 				select {
 				case <-ctx.Done(): // if ctx is done, stop immediately, in case of deadlock
 					return
-				case jobs <- f: // send job when worker is ready to receive
+				case s.jobs <- f: // send job when worker is ready to receive
+					queueDepth.Add(-1, "due")
 				}
 			}
 		}
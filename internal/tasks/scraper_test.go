@@ -0,0 +1,86 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Settings changed through one instance reach the others on their next sync,
+// not only the one the admin request landed on.
+func TestScraperSettingsAreShared(t *testing.T) {
+	conn := openTestDB(t)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		_, err := conn.Exec("UPDATE scraper_settings SET paused = FALSE, concurrency = NULL, interval_seconds = NULL")
+		if err != nil {
+			t.Errorf("cleanup: %v", err)
+		}
+	})
+
+	opts := Options{Concurrency: 5, Interval: 10 * time.Second}
+	a, b := NewScraper(conn, opts), NewScraper(conn, opts)
+
+	if err := a.Pause(ctx); err != nil {
+		t.Fatal(err)
+	}
+	concurrency, interval := 2, time.Minute
+	if err := a.SetPace(ctx, &concurrency, &interval); err != nil {
+		t.Fatal(err)
+	}
+	if status := a.Status(); !status.Paused || status.Concurrency != 2 || status.Interval != time.Minute {
+		t.Errorf("a = %+v, want paused, concurrency 2, interval 1m", status)
+	}
+
+	if err := b.syncSettings(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if status := b.Status(); !status.Paused || status.Concurrency != 2 || status.Interval != time.Minute {
+		t.Errorf("b = %+v, want paused, concurrency 2, interval 1m", status)
+	}
+	if _, _, err := b.Refresh(ctx, uuid.New(), 0); !errors.Is(err, ErrScraperPaused) {
+		t.Errorf("b refresh: err = %v, want ErrScraperPaused", err)
+	}
+
+	if err := b.Resume(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.syncSettings(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if a.Status().Paused {
+		t.Error("a still paused after b resumed")
+	}
+}
+
+// A request with one bad value changes nothing, not even the valid one.
+func TestScraperSetPaceValidatesFirst(t *testing.T) {
+	conn := openTestDB(t)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		_, err := conn.Exec("UPDATE scraper_settings SET paused = FALSE, concurrency = NULL, interval_seconds = NULL")
+		if err != nil {
+			t.Errorf("cleanup: %v", err)
+		}
+	})
+
+	s := NewScraper(conn, Options{Concurrency: 5, Interval: 10 * time.Second})
+	concurrency, interval := 4, -time.Second
+	if err := s.SetPace(ctx, &concurrency, &interval); !errors.Is(err, ErrInvalidSetting) {
+		t.Fatalf("SetPace: err = %v, want ErrInvalidSetting", err)
+	}
+
+	settings, err := s.db.GetScraperSettings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Concurrency.Valid || settings.IntervalSeconds.Valid {
+		t.Errorf("settings = %+v, want nothing saved", settings)
+	}
+	if status := s.Status(); status.Concurrency != 5 || status.Interval != 10*time.Second {
+		t.Errorf("status = %+v, want concurrency 5, interval 10s", status)
+	}
+}
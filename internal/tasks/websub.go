@@ -0,0 +1,130 @@
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
+	"github.com/google/uuid"
+)
+
+const (
+	// WebSubLease is what we ask for. The hub has the last word but a longer
+	// lease than that is capped, we renew at our pace.
+	WebSubLease = 10 * 24 * time.Hour
+	// renew that long before the lease expires (half the lease for short ones)
+	websubRenewBefore = 24 * time.Hour
+	// a hub that didn't verify or denied us is asked again after that
+	websubRetryAfter = 6 * time.Hour
+)
+
+// websubTopic is the URL to subscribe to, the feed's rel="self" when it has
+// one since that's what the hub knows it by.
+func websubTopic(parsed feeds.Feed, feedURL string) string {
+	if parsed.Self != "" {
+		return parsed.Self
+	}
+	return feedURL
+}
+
+// WebSubCallbackURL is where the hub calls us back for a feed, served by the
+// API under /v1/websub/{feedID}.
+func WebSubCallbackURL(baseURL string, feedID uuid.UUID) string {
+	return strings.TrimRight(baseURL, "/") + "/v1/websub/" + feedID.String()
+}
+
+func newWebSubSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret) // never fails (crypto/rand)
+	return hex.EncodeToString(secret)
+}
+
+// syncWebSub subscribes the feed to its hub, or renews the subscription, when
+// needed. hub and topic are what the feed advertises, "" to go on with the
+// current subscription (304, we didn't get the document).
+//
+// ok is true while the hub pushes to us, pollInterval is then how long we can
+// go without polling: up to maxFetchInterval, but early enough to renew.
+func (s *Scraper) syncWebSub(ctx context.Context, feedID uuid.UUID, hub, topic string) (pollInterval time.Duration, ok bool) {
+	if s.opts.WebSubCallbackURL == "" {
+		return 0, false
+	}
+
+	sub, err := s.db.GetWebsubSubscription(ctx, feedID)
+	found := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Error getting WebSub subscription of feed %s: %v", feedID, err)
+		return 0, false
+	}
+
+	if hub == "" {
+		if !found {
+			return 0, false // no hub advertised
+		}
+		hub, topic = sub.HubUrl, sub.TopicUrl
+	}
+
+	subscribed := found && sub.State == "subscribed"
+	lease := time.Duration(sub.LeaseSeconds.Int32) * time.Second
+	renewIn := time.Duration(sub.LeaseRemainingSeconds)*time.Second - min(websubRenewBefore, lease/2)
+	requestedAgo := time.Duration(sub.RequestedSecondsAgo) * time.Second
+
+	secret := sub.Secret
+	switch {
+	case !found || sub.HubUrl != hub || sub.TopicUrl != topic:
+		secret = newWebSubSecret()
+	case subscribed && renewIn <= 0:
+		// renewal keeps the secret, pushes already on their way stay valid
+	case !subscribed && requestedAgo >= websubRetryAfter:
+		secret = newWebSubSecret()
+	default:
+		if subscribed {
+			return min(max(renewIn, minFetchInterval), maxFetchInterval), true
+		}
+		return 0, false // waiting for the hub to verify
+	}
+
+	s.subscribe(ctx, feedID, hub, topic, secret)
+	return 0, false // poll as usual until the hub verifies
+}
+
+// subscribe records the request before sending it, the hub may verify before
+// it even answers us.
+func (s *Scraper) subscribe(ctx context.Context, feedID uuid.UUID, hub, topic, secret string) {
+	err := s.db.UpsertWebsubSubscription(ctx, database.UpsertWebsubSubscriptionParams{
+		FeedID:   feedID,
+		HubUrl:   hub,
+		TopicUrl: topic,
+		Secret:   secret,
+	})
+	if err != nil {
+		log.Printf("Error saving WebSub subscription of feed %s: %v", feedID, err)
+		return
+	}
+
+	callback := WebSubCallbackURL(s.opts.WebSubCallbackURL, feedID)
+	if err := feeds.Subscribe(ctx, hub, topic, callback, secret, WebSubLease); err != nil {
+		// polling goes on, we'll ask again after websubRetryAfter
+		log.Printf("Error subscribing feed %s to hub %s: %v", feedID, hub, err)
+		return
+	}
+	log.Printf("Feed %s subscribed to hub %s, waiting for verification", feedID, hub)
+}
+
+// IngestPushedFeed stores the content a WebSub hub pushed for a feed, the
+// same way polled content is stored. retention is the global post retention.
+func IngestPushedFeed(ctx context.Context, conn *sql.DB, db *database.Queries, feedID uuid.UUID, parsed feeds.Feed, retention RetentionPolicy) error {
+	stats, err := ingestItems(ctx, conn, db, feedID, parsed.Items, retention)
+	if err != nil {
+		return err
+	}
+	log.Printf("WebSub push for feed %s: %d new, %d updated, %d unchanged posts", feedID, stats.inserted, stats.updated, stats.skipped)
+	return nil
+}
@@ -7,12 +7,15 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	"github.com/alepaez-dev/rss_aggregator/internal/api"
 	"github.com/alepaez-dev/rss_aggregator/internal/database"
+	"github.com/alepaez-dev/rss_aggregator/internal/feeds"
 	"github.com/alepaez-dev/rss_aggregator/internal/tasks"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq" // postgres driver
 )
@@ -20,16 +23,17 @@ import (
 /*
 EXPLANATION OF THE FLOW:
 1. We create root context in main
-2. We subscribe to OS shutdown signals (Ctrl-C) and listen for those signals to do a graceful shutdown in sigCh channel which block (<-sigCh on line 85) needs to be after the goroutines so we don;t block them.
+2. We subscribe to OS shutdown signals (Ctrl-C) and listen for those signals to do a graceful shutdown in sigCh channel which block (<-sigCh on line 177) needs to be after the goroutines so we don;t block them.
 3. We create DB connection, router, etc
-4. We do a scrapeDone channel that will block main program on line 92 (at the end of main). Unless we send a signal here main will never shutdown (unless server never starts, log.Fatal will shutdown everything, is fine).
-5. We start the StartScraping in a goroutine(async) with the root context. When the StartScraping finishes synchronously it closes the scrapeDone channel unblocking main program on line 93.
+4. We do a scrapeDone channel that will block main program on line 185 (at the end of main). Unless we send a signal here main will never shutdown (unless server never starts, log.Fatal will shutdown everything, is fine).
+5. We start scraper.Run in a goroutine(async) with the root context. When scraper.Run finishes synchronously it closes the scrapeDone channel unblocking main program on line 185.
 6. We start the HTTP server in another goroutine(async).
-7. Once ctrl-c is done <-sigCh is unblocked on line 85 we continue with line 86 execution which is cancel(), it will cancel the root context which will propagate to StartScraping and all of it's child workers.
-8. StartScraping exits only after all workers finish. Everything is done gracefully there.
-9. The main program will wait for StartScraping to finish on line 93 <-scrapeDone
-10. Before we reach line 93 (StartScraping is currently finishing here) we shut down server gracefully with a timeout context of 10 seconds.
-11. Once the server finishes or timeout is reached we go to line 93 where main waits for StartScraping to finish if it hasn't already.
+7. Once ctrl-c is done <-sigCh is unblocked on line 177 we continue with line 178 execution which is cancel(), it will cancel the root context which will propagate to scraper.Run and all of it's child workers.
+8. scraper.Run exits only after all workers finish. Everything is done gracefully there.
+9. The main program will wait for scraper.Run to finish on line 185 <-scrapeDone
+10. Before we reach line 185 (scraper.Run is currently finishing here) we shut down server gracefully with a timeout context of 10 seconds.
+11. Once the server finishes or timeout is reached we go to line 185 where main waits for scraper.Run to finish if it hasn't already.
+12. scheduler.Run (maintenance jobs) follows the same pattern with its jobsDone channel, main waits for it right after scrapeDone.
 */
 func main() {
 	// Root context
@@ -58,19 +62,107 @@ func main() {
 	}
 	defer conn.Close()
 
+	// failures in a row before a feed gets disabled
+	maxFeedFailures := 10
+	if value := os.Getenv("FEED_MAX_FAILURES"); value != "" {
+		maxFeedFailures, err = strconv.Atoi(value)
+		if err != nil || maxFeedFailures <= 0 {
+			log.Fatal("FEED_MAX_FAILURES must be a positive number")
+		}
+	}
+
+	// internal hosts/ranges the scraper may fetch despite the SSRF checks,
+	// e.g. FEED_FETCH_ALLOWLIST="feeds.internal,10.20.0.0/16"
+	allowlist, err := feeds.ParseAllowlist(os.Getenv("FEED_FETCH_ALLOWLIST"))
+	if err != nil {
+		log.Fatal("FEED_FETCH_ALLOWLIST: ", err)
+	}
+	feeds.SetAllowlist(allowlist)
+
+	if value := os.Getenv("FEED_MAX_BODY_BYTES"); value != "" {
+		maxBodySize, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxBodySize <= 0 {
+			log.Fatal("FEED_MAX_BODY_BYTES must be a positive number")
+		}
+		feeds.SetMaxBodySize(maxBodySize)
+	}
+
+	// permanent redirects in a row before a feed URL is rewritten
+	feedRedirectThreshold := 3
+	if value := os.Getenv("FEED_REDIRECT_THRESHOLD"); value != "" {
+		feedRedirectThreshold, err = strconv.Atoi(value)
+		if err != nil || feedRedirectThreshold <= 0 {
+			log.Fatal("FEED_REDIRECT_THRESHOLD must be a positive number")
+		}
+	}
+
+	// post retention, per feed overrides are set by admins. 0 = no limit.
+	retention := tasks.RetentionPolicy{Floor: 7 * 24 * time.Hour}
+	if value := os.Getenv("POST_RETENTION_DAYS"); value != "" {
+		retention.KeepDays, err = strconv.Atoi(value)
+		if err != nil || retention.KeepDays < 0 {
+			log.Fatal("POST_RETENTION_DAYS must be a number >= 0")
+		}
+	}
+	if value := os.Getenv("POST_RETENTION_MAX_POSTS"); value != "" {
+		retention.KeepPosts, err = strconv.Atoi(value)
+		if err != nil || retention.KeepPosts < 0 {
+			log.Fatal("POST_RETENTION_MAX_POSTS must be a number >= 0")
+		}
+	}
+	// posts published or stored more recently are never pruned
+	if value := os.Getenv("POST_RETENTION_FLOOR_DAYS"); value != "" {
+		floorDays, err := strconv.Atoi(value)
+		if err != nil || floorDays < 0 {
+			log.Fatal("POST_RETENTION_FLOOR_DAYS must be a number >= 0")
+		}
+		retention.Floor = time.Duration(floorDays) * 24 * time.Hour
+	}
+
+	// public URL of this API, WebSub hubs call it back. Unset = polling only.
+	websubCallbackURL := os.Getenv("WEBSUB_CALLBACK_URL")
+
 	queries := database.New(conn)
+	// concurrency and interval are only where it starts, admins can change them live
+	scraper := tasks.NewScraper(conn, tasks.Options{
+		Concurrency:       5,
+		Interval:          10 * time.Second,
+		MaxFailures:       maxFeedFailures,
+		RedirectThreshold: feedRedirectThreshold,
+		WebSubCallbackURL: websubCallbackURL,
+		Retention:         retention,
+	})
+	pruner := tasks.NewPruner(conn, retention)
 	cfg := api.ApiConfig{
-		DB: queries,
+		DB:      queries,
+		Scraper: scraper,
+		Pruner:  pruner,
+		IngestPushedFeed: func(ctx context.Context, feedID uuid.UUID, parsed feeds.Feed) error {
+			return tasks.IngestPushedFeed(ctx, conn, queries, feedID, parsed, retention)
+		},
+	}
+
+	// maintenance jobs, each run happens on one instance only
+	scheduler := tasks.NewScheduler(conn)
+	if err := scheduler.Register("prune-posts", "30 * * * *", pruner.Prune); err != nil {
+		log.Fatal(err)
 	}
 
 	scrapeDone := make(chan struct{})
+	jobsDone := make(chan struct{})
 
 	// async
 	go func() {
-		tasks.StartScraping(ctx, queries, 5, 10*time.Second)
+		scraper.Run(ctx)
 		close(scrapeDone)
 	}()
 
+	// async, same as the scraper
+	go func() {
+		scheduler.Run(ctx)
+		close(jobsDone)
+	}()
+
 	mainRouter := api.NewRouter(&cfg)
 	server := newServer(":"+port, mainRouter)
 	// async
@@ -83,13 +175,14 @@ func main() {
 	}()
 
 	<-sigCh  // wait for ctrl-c or killl (main is blocker here we can't finish program)
-	cancel() // cancel root context, it will propagate to all children in StartScraping
+	cancel() // cancel root context, it will propagate to all children in scraper.Run and scheduler.Run
 
 	// need new context to use timeout bcs root context is cancelled already at this line
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer shutdownCancel()
 	_ = server.Shutdown(shutdownCtx) // server has 10 seconds to shutdown gracefully or bye
 
-	<-scrapeDone // wait for scraping to finish, and StartScraping is waiting for it's workers to finish. Even a Ctrl-C or SIGTERM/SIGINT shutdown wll handle everything gracefully. (not a kill -9 tho)
+	<-scrapeDone // wait for scraping to finish, and scraper.Run is waiting for it's workers to finish. Even a Ctrl-C or SIGTERM/SIGINT shutdown wll handle everything gracefully. (not a kill -9 tho)
+	<-jobsDone   // same for the maintenance jobs running right now
 
 }